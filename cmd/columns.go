@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// columnMapping maps the logical column names used by the tool to the column names in the header of a CSV file.
+// Logical columns which are not in the mapping are expected to use the same name in the header.
+type columnMapping map[string]string
+
+// column returns the name of the logical column `name` in the CSV header
+func (c columnMapping) column(name string) string {
+	if column, ok := c[name]; ok {
+		return column
+	}
+	return name
+}
+
+// dataset describes a file of the IMDB dataset whose columns can be mapped
+type dataset struct {
+	// name identifies the dataset in the column mapping file
+	name string
+	// file is the name of the file inside the zipped IMDB dataset
+	file string
+	// columns lists the logical columns read from the file
+	columns []string
+	// mapping is the column mapping used when reading the file
+	mapping columnMapping
+}
+
+var (
+	metadataDataset = &dataset{
+		name:    "movies_metadata",
+		file:    "movies_metadata.csv",
+		columns: []string{"id", "title", "original_title", "production_companies", "revenue", "budget", "release_date"},
+	}
+	creditsDataset = &dataset{
+		name:    "credits",
+		file:    "credits.csv",
+		columns: []string{"id", "cast", "crew"},
+	}
+	ratingsDataset = &dataset{
+		name:    "ratings",
+		file:    "ratings.csv",
+		columns: []string{"movieId", "userId", "rating"},
+	}
+	linksDataset = &dataset{
+		name:    "links",
+		file:    "links.csv",
+		columns: []string{"movieId", "imdbId", "tmdbId"},
+	}
+
+	datasets = []*dataset{metadataDataset, creditsDataset, ratingsDataset, linksDataset}
+
+	columnsFile     string
+	lenientColumns  bool
+	metadataColumns map[string]string
+	creditsColumns  map[string]string
+	ratingsColumns  map[string]string
+	linksColumns    map[string]string
+)
+
+// loadColumnMappings sets the column mapping of each dataset from the column mapping file and flags.
+// Mappings given by flags take precedence over the file.
+func loadColumnMappings() error {
+	fileMappings := map[string]map[string]string{}
+	if columnsFile != "" {
+		contents, err := ioutil.ReadFile(columnsFile)
+		if err != nil {
+			return fmt.Errorf("could not read column mapping file: %v", err)
+		}
+
+		// JSON is valid YAML so both formats can be parsed with the same decoder
+		if err := yaml.UnmarshalStrict(contents, &fileMappings); err != nil {
+			return fmt.Errorf("could not parse column mapping file %q: %v", columnsFile, err)
+		}
+	}
+
+	for name := range fileMappings {
+		if datasetByName(name) == nil {
+			return fmt.Errorf("unknown dataset %q in column mapping file, expected one of %s", name, datasetNames())
+		}
+	}
+
+	flagMappings := map[*dataset]map[string]string{
+		metadataDataset: metadataColumns,
+		creditsDataset:  creditsColumns,
+		ratingsDataset:  ratingsColumns,
+		linksDataset:    linksColumns,
+	}
+
+	for _, d := range datasets {
+		d.mapping = make(columnMapping)
+		for _, mapping := range []map[string]string{fileMappings[d.name], flagMappings[d]} {
+			for logical, column := range mapping {
+				if !contains(d.columns, logical) {
+					return fmt.Errorf("unknown column %q for dataset %q, expected one of %s", logical, d.name, strings.Join(d.columns, ", "))
+				}
+				d.mapping[logical] = column
+			}
+		}
+	}
+
+	return nil
+}
+
+func datasetByName(name string) *dataset {
+	for _, d := range datasets {
+		if d.name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+func datasetNames() string {
+	names := make([]string, 0, len(datasets))
+	for _, d := range datasets {
+		names = append(names, d.name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// missingColumnsError is returned when required columns are missing from the header of a CSV file
+type missingColumnsError struct {
+	inputFile string
+	missing   []missingColumn
+	// header is the list of column names in the header of the file
+	header []string
+}
+
+// missingColumn is a required column which is missing from the header of a CSV file
+type missingColumn struct {
+	// name is the logical name of the column
+	name string
+	// column is the name the column was expected to have in the header
+	column string
+	// suggestions are column names in the header which are similar to `column`
+	suggestions []string
+}
+
+func (e *missingColumnsError) Error() string {
+	sBuilder := new(strings.Builder)
+	fmt.Fprintf(sBuilder, "%s is missing required columns:", e.inputFile)
+	for i, m := range e.missing {
+		if i > 0 {
+			sBuilder.WriteString(",")
+		}
+		fmt.Fprintf(sBuilder, " %q", m.column)
+		if m.column != m.name {
+			fmt.Fprintf(sBuilder, " (mapped from %q)", m.name)
+		}
+		if len(m.suggestions) > 0 {
+			fmt.Fprintf(sBuilder, " (did you mean %s?)", quoteJoin(m.suggestions, " or "))
+		}
+	}
+	fmt.Fprintf(sBuilder, "; the header contains %s", quoteJoin(e.header, ", "))
+
+	return sBuilder.String()
+}
+
+// maxSuggestionDistance is the maximum edit distance between a missing column and a header column
+// for the header column to be suggested
+const maxSuggestionDistance = 3
+
+// checkRequiredColumns returns a `*missingColumnsError` if any of the `required` columns were not found in `header`
+func checkRequiredColumns(required []string, mapping columnMapping, indices map[string]int, header []string, inputFile string) error {
+	var missing []missingColumn
+	for _, name := range required {
+		if _, ok := indices[name]; ok {
+			continue
+		}
+
+		column := mapping.column(name)
+		missing = append(missing, missingColumn{
+			name:        name,
+			column:      column,
+			suggestions: similarColumns(column, header),
+		})
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return &missingColumnsError{
+		inputFile: inputFile,
+		missing:   missing,
+		header:    header,
+	}
+}
+
+// similarColumns returns the columns in `header` with the smallest edit distance to `column`, ignoring case.
+// Only columns within `maxSuggestionDistance` edits are returned.
+func similarColumns(column string, header []string) []string {
+	var res []string
+	bestDistance := maxSuggestionDistance + 1
+	for _, h := range header {
+		distance := editDistance(strings.ToLower(column), strings.ToLower(h))
+		// Avoid suggesting unrelated columns, e.g. "id" for "title"
+		if distance > len([]rune(column))/2 {
+			continue
+		}
+
+		switch {
+		case distance < bestDistance:
+			bestDistance = distance
+			res = []string{h}
+		case distance == bestDistance:
+			res = append(res, h)
+		}
+	}
+
+	return res
+}
+
+// editDistance returns the Levenshtein distance between `a` and `b`
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func quoteJoin(values []string, sep string) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, fmt.Sprintf("%q", v))
+	}
+	return strings.Join(quoted, sep)
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_loadColumnMappings(t *testing.T) {
+	defer func() {
+		columnsFile, metadataColumns, creditsColumns, ratingsColumns = "", nil, nil, nil
+		require.NoError(t, loadColumnMappings())
+	}()
+
+	tests := []struct {
+		name            string
+		file            string
+		metadataColumns map[string]string
+		expected        columnMapping
+		wantErr         bool
+	}{
+		{
+			name:     "no mapping",
+			expected: columnMapping{},
+		},
+		{
+			name: "yaml file",
+			file: `
+movies_metadata:
+  id: tmdb_id
+  release_date: released
+`,
+			expected: columnMapping{"id": "tmdb_id", "release_date": "released"},
+		},
+		{
+			name:     "json file",
+			file:     `{"movies_metadata": {"id": "tmdb_id"}}`,
+			expected: columnMapping{"id": "tmdb_id"},
+		},
+		{
+			name:            "flags take precedence over file",
+			file:            `{"movies_metadata": {"id": "tmdb_id", "budget": "cost"}}`,
+			metadataColumns: map[string]string{"id": "movie_id"},
+			expected:        columnMapping{"id": "movie_id", "budget": "cost"},
+		},
+		{
+			name:    "unknown dataset",
+			file:    `{"movies": {"id": "tmdb_id"}}`,
+			wantErr: true,
+		},
+		{
+			name:            "unknown column",
+			metadataColumns: map[string]string{"cast": "cast_json"},
+			wantErr:         true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			columnsFile = ""
+			if test.file != "" {
+				columnsFile = filepath.Join(t.TempDir(), "columns.yaml")
+				require.NoError(t, ioutil.WriteFile(columnsFile, []byte(test.file), 0644))
+			}
+			metadataColumns = test.metadataColumns
+
+			err := loadColumnMappings()
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, metadataDataset.mapping)
+			require.Equal(t, columnMapping{}, creditsDataset.mapping)
+		})
+	}
+}
@@ -1,11 +1,8 @@
 package cmd
 
 import (
-	"bufio"
-	"encoding/csv"
 	"fmt"
-	"os"
-	"strings"
+	"io"
 
 	"github.com/spf13/cobra"
 )
@@ -17,110 +14,147 @@ var (
 		RunE:  combine,
 		Args:  cobra.ExactArgs(4),
 	}
+
+	combineOutput string
+	combineSortBy string
+	combineFormat string
+	linksFile     string
 )
 
+func init() {
+	combineCmd.Flags().StringVarP(&combineOutput, "output", "o", "output_combine.csv", "output file, or - for stdout")
+	combineCmd.Flags().StringVar(&combineSortBy, "sort-by", "id", "output column to sort by, followed by :asc or :desc for the direction")
+	combineCmd.Flags().StringVar(&combineFormat, "format", formatCSV, "output format, one of csv, jsonl or parquet")
+	combineCmd.Flags().StringVar(&linksFile, "links-file", "", "links file mapping the MovieLens ids of the ratings to the TMDB ids of the movies metadata")
+	addRatingFlags(combineCmd)
+}
+
 func combine(cmd *cobra.Command, args []string) error {
-	metadataFile, err := os.Open(args[0])
+	order, err := outputSortOrder(combineSortBy, columnNames(combineColumns))
 	if err != nil {
 		return err
 	}
-	defer metadataFile.Close()
+	if err := checkOutputFormat(combineFormat); err != nil {
+		return err
+	}
+	if !cmd.Flags().Changed("output") {
+		combineOutput = formatOutputPath(combineOutput, combineFormat)
+	}
 
-	moviesMetadataStats := makeStats(args[0])
 	moviesMetadata := make(moviesMetadata)
-	err = readCSV(
-		csv.NewReader(bufio.NewReader(metadataFile)),
-		moviesMetadataStats,
-		[]string{"id", "title", "budget", "revenue", "release_date", "production_companies", "original_title"},
+	err = readCSVFile(
+		args[0],
+		metadataDataset,
+		csvColumns{
+			required: []string{"id", "title", "budget", "revenue", "release_date"},
+			optional: []string{"production_companies", "original_title"},
+		},
 		readMoviesMetadata(moviesMetadata),
 	)
 	if err != nil {
 		return err
 	}
 
-	fmt.Print(moviesMetadataStats)
-
-	ratioFile, err := os.Open(args[1])
-	if err != nil {
-		return err
-	}
-	defer ratioFile.Close()
-
-	ratioStats := makeStats(args[1])
 	moviesRatios := make(moviesRatios)
-	err = readCSV(
-		csv.NewReader(bufio.NewReader(ratioFile)),
-		ratioStats,
-		[]string{"id", "ratio"},
+	err = readCSVFile(
+		args[1],
+		nil,
+		csvColumns{required: []string{"id", "ratio"}},
 		readMoviesRatio(moviesRatios),
 	)
 	if err != nil {
 		return err
 	}
 
-	fmt.Print(ratioStats)
-
-	matchingFile, err := os.Open(args[2])
-	if err != nil {
-		return err
-	}
-	defer matchingFile.Close()
-
-	wikiStats := makeStats(args[2])
 	wikiMatches := make(wikiMatches)
-	err = readCSV(
-		csv.NewReader(bufio.NewReader(matchingFile)),
-		wikiStats,
-		[]string{"id", "abstract", "url", "score"},
+	err = readCSVFile(
+		args[2],
+		nil,
+		csvColumns{required: []string{"id", "abstract", "url", "score"}},
 		readWikiMatches(wikiMatches),
 	)
 	if err != nil {
 		return err
 	}
 
-	fmt.Print(wikiStats)
-
-	ratingFile, err := os.Open(args[3])
-	if err != nil {
-		return err
+	// Without links the ratings are assumed to use the same ids as the movies metadata
+	var links movieLinks
+	if linksFile != "" {
+		links = make(movieLinks)
+		err = readCSVFile(
+			linksFile,
+			linksDataset,
+			csvColumns{required: []string{"movieId", "tmdbId"}},
+			readMovieLinks(links),
+		)
+		if err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintln(logOutput, "WARNING: no links file given, the movieId of each rating is assumed to be the TMDB id of the movie")
 	}
-	defer ratingFile.Close()
 
-	ratingsStats := makeStats(args[3])
 	ratings := make(ratings)
-	err = readCSV(
-		csv.NewReader(bufio.NewReader(ratingFile)),
-		ratingsStats,
-		[]string{"movieId", "userId", "rating"},
-		readMoviesRating(ratings),
-	)
+	err = readRatingsFile(args[3], links, ratings)
 	if err != nil {
 		return err
 	}
 
-	fmt.Print(ratingsStats)
-
-	fout, err := os.Create("output_combine.csv")
+	prior, err := ratingPriorFromFlags(cmd, ratings)
 	if err != nil {
 		return err
 	}
-	defer fout.Close()
 
-	writer := csv.NewWriter(fout)
-	if err := writer.Write([]string{"id", "title", "url", "abstract",
-		"score", "budget", "year", "revenue",
-		"ratio", "rating", "production_companies"}); err != nil {
-		return err
-	}
+	combinedData := combineData(moviesMetadata, moviesRatios, wikiMatches, ratings, prior)
+	return writeFile(combineOutput, func(w io.Writer) error { return writeCombined(w, combinedData, combineFormat, order) })
+}
 
+// combineData joins the movies metadata with its ratio, Wikipedia match and ratings, weighting the rating by `prior`.
+// Only movies which have been matched with a Wikipedia entry are included.
+func combineData(moviesMetadata moviesMetadata, moviesRatios moviesRatios, wikiMatches wikiMatches, ratings ratings, prior ratingPrior) []*combinedData {
+	res := make([]*combinedData, 0, len(wikiMatches))
 	for id, info := range moviesMetadata {
-		if match, ok := wikiMatches[id]; ok {
-			writer.Write([]string{id, info.title, match.url, match.abstract,
-				fmt.Sprintf("%f", match.score), fmt.Sprintf("%d", info.budget), info.year.Format("2006-01-02"), fmt.Sprintf("%d", info.revenue),
-				moviesRatios.forID(id), ratings.forID(id), strings.Join(info.production, ";")})
+		match, ok := wikiMatches[id]
+		if !ok {
+			continue
 		}
+
+		res = append(res, &combinedData{
+			id:                  id,
+			title:               info.title,
+			year:                info.year,
+			rating:              ratings.value(id),
+			budget:              info.budget,
+			revenue:             info.revenue,
+			ratio:               moviesRatios.value(id),
+			productionCompanies: info.production,
+			url:                 match.url,
+			abstract:            match.abstract,
+			score:               match.score,
+			ratingCount:         ratings.count(id),
+			ratingMedian:        ratings.median(id),
+			weightedRating:      ratings.weighted(id, prior),
+		})
+	}
+
+	return res
+}
+
+// combineColumns are the columns of the file written by `writeCombined`
+var combineColumns = []outputColumn{{"id", typeString}, {"title", typeString}, {"url", typeString}, {"abstract", typeString},
+	{"score", typeFloat}, {"budget", typeInt}, {"year", typeDate}, {"revenue", typeInt},
+	{"ratio", typeFloat}, {"rating", typeFloat}, {"rating_median", typeFloat}, {"weighted_rating", typeFloat},
+	{"rating_count", typeInt}, {"production_companies", typeList}}
+
+// writeCombined writes the combined data in the given format. CSV files can be read back with `readCombinedData`.
+func writeCombined(w io.Writer, data []*combinedData, format string, order sortOrder) error {
+	t := &outputTable{columns: combineColumns, rows: make([][]interface{}, 0, len(data))}
+	for _, d := range data {
+		t.rows = append(t.rows, []interface{}{d.id, d.title, d.url, d.abstract,
+			d.score, d.budget, d.year, d.revenue,
+			d.ratio, d.rating, d.ratingMedian, d.weightedRating,
+			d.ratingCount, d.productionCompanies})
 	}
 
-	writer.Flush()
-	return writer.Error()
+	return writeTable(w, format, t, order)
 }
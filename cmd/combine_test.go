@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_combineData(t *testing.T) {
+	metadata := moviesMetadata{
+		"0": &movieMetadata{title: "film foo", budget: 10, revenue: 100, production: []string{"foo productions"}},
+		"1": &movieMetadata{title: "film bar", budget: 0, revenue: 100},
+		"2": &movieMetadata{title: "film baz", budget: 10, revenue: 20},
+	}
+	ratios, numSkipped := metadata.ratios()
+	require.Equal(t, 1, numSkipped)
+	require.EqualValues(t, 10, ratios["0"])
+
+	matches := wikiMatches{
+		"0": &wikiMatch{url: "https://en.wikipedia.org/wiki/Foo", abstract: "foo", score: 0.5},
+		"1": &wikiMatch{url: "https://en.wikipedia.org/wiki/Bar", abstract: "bar", score: 0.8},
+	}
+	ratings := ratings{
+		"0": &ratingInfo{cumulativeRating: 9, numberOfRatings: 2},
+	}
+
+	res := combineData(metadata, ratios, matches, ratings, ratingPrior{mean: 3, votes: 2})
+
+	// Only matched movies are combined
+	require.Len(t, res, 2)
+	byID := map[string]*combinedData{}
+	for _, d := range res {
+		byID[d.id] = d
+	}
+
+	require.Equal(t, "film foo", byID["0"].title)
+	require.Equal(t, "https://en.wikipedia.org/wiki/Foo", byID["0"].url)
+	require.Equal(t, float32Ptr(10), byID["0"].ratio)
+	require.Equal(t, float32Ptr(4.5), byID["0"].rating)
+	require.Equal(t, 2, byID["0"].ratingCount)
+	require.Equal(t, []string{"foo productions"}, byID["0"].productionCompanies)
+
+	// Missing ratio and ratings
+	require.Nil(t, byID["1"].ratio)
+	require.Nil(t, byID["1"].rating)
+	require.Equal(t, 0, byID["1"].ratingCount)
+}
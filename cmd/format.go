@@ -0,0 +1,305 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/writerfile"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const (
+	formatCSV     = "csv"
+	formatJSONL   = "jsonl"
+	formatParquet = "parquet"
+)
+
+// outputFormats are the formats output files can be written in
+var outputFormats = []string{formatCSV, formatJSONL, formatParquet}
+
+// checkOutputFormat returns an error if `format` is not one of `outputFormats`
+func checkOutputFormat(format string) error {
+	if !contains(outputFormats, format) {
+		return fmt.Errorf("unknown output format %q, expected one of %s", format, strings.Join(outputFormats, ", "))
+	}
+	return nil
+}
+
+// formatOutputPath replaces the extension of the default output path of a command with the extension of `format`
+func formatOutputPath(path string, format string) string {
+	if path == stdoutPath {
+		return path
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path)) + "." + format
+}
+
+// columnType is the type of the values of an output column
+type columnType int
+
+const (
+	// typeString values are strings
+	typeString columnType = iota
+	// typeInt values are ints
+	typeInt
+	// typeFloat values are float32 or float64, or *float32 with nil for missing values
+	typeFloat
+	// typeDate values are time.Time, with the zero time for missing values
+	typeDate
+	// typeList values are []string
+	typeList
+)
+
+// outputColumn is a column of an output file
+type outputColumn struct {
+	name string
+	typ  columnType
+}
+
+// outputTable holds the rows of an output file, with the values of each row given in the order of the columns
+type outputTable struct {
+	columns []outputColumn
+	rows    [][]interface{}
+}
+
+func (t *outputTable) header() []string {
+	return columnNames(t.columns)
+}
+
+// columnNames returns the names of output columns
+func columnNames(columns []outputColumn) []string {
+	res := make([]string, 0, len(columns))
+	for _, c := range columns {
+		res = append(res, c.name)
+	}
+	return res
+}
+
+// writeTable writes the rows of `t` sorted by `order` in the given format
+func writeTable(w io.Writer, format string, t *outputTable, order sortOrder) error {
+	if err := order.sort(t); err != nil {
+		return err
+	}
+
+	switch format {
+	case formatJSONL:
+		return writeJSONL(w, t)
+	case formatParquet:
+		return writeParquet(w, t)
+	default:
+		return writeCSVTable(w, t)
+	}
+}
+
+// formatCSVValue formats a value of an output table as a CSV cell, where missing values are empty
+func formatCSVValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int:
+		return fmt.Sprintf("%d", v)
+	case float32, float64:
+		return fmt.Sprintf("%f", v)
+	case *float32:
+		if v == nil {
+			return ""
+		}
+		return fmt.Sprintf("%f", *v)
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format("2006-01-02")
+	case []string:
+		return joinList(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// joinList joins a list into a CSV cell with `;` between the values, where `;` and `\` in a value are escaped by `\`
+func joinList(values []string) string {
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = listEscaper.Replace(value)
+	}
+	return strings.Join(escaped, ";")
+}
+
+var listEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`)
+
+// splitList splits a CSV cell written by `joinList` back into a list. Like `strings.Split`, it returns
+// a single empty value for an empty cell.
+func splitList(s string) []string {
+	var res []string
+	var value strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			value.WriteByte(s[i])
+		case s[i] == ';':
+			res = append(res, value.String())
+			value.Reset()
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+	return append(res, value.String())
+}
+
+func writeCSVTable(w io.Writer, t *outputTable) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(t.header()); err != nil {
+		return err
+	}
+
+	record := make([]string, len(t.columns))
+	for _, row := range t.rows {
+		for i, v := range row {
+			record[i] = formatCSVValue(v)
+		}
+		writer.Write(record)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// jsonValue encodes a value of an output table as JSON, with null for missing floats and dates.
+// Dates are written as `2006-01-02` strings, or as the number of days since 1970-01-01 if `epochDays` is set.
+func jsonValue(v interface{}, epochDays bool) ([]byte, error) {
+	switch v := v.(type) {
+	case *float32:
+		if v == nil {
+			return []byte("null"), nil
+		}
+		return jsonValue(*v, epochDays)
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return []byte("null"), nil
+		}
+		return []byte(strconv.FormatFloat(float64(v), 'g', -1, 32)), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return []byte("null"), nil
+		}
+		return []byte(strconv.FormatFloat(v, 'g', -1, 64)), nil
+	case time.Time:
+		if v.IsZero() {
+			return []byte("null"), nil
+		}
+		if epochDays {
+			return []byte(strconv.FormatInt(v.Unix()/(24*60*60), 10)), nil
+		}
+		return json.Marshal(v.Format("2006-01-02"))
+	case []string:
+		if v == nil {
+			v = []string{}
+		}
+		return json.Marshal(v)
+	default:
+		return json.Marshal(v)
+	}
+}
+
+// jsonRow encodes a row of an output table as a JSON object with the keys in the order of the columns
+func jsonRow(t *outputTable, row []interface{}, epochDays bool) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("{")
+	for i, v := range row {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		key, _ := json.Marshal(t.columns[i].name)
+		value, err := jsonValue(v, epochDays)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteString(":")
+		b.Write(value)
+	}
+	b.WriteString("}")
+
+	return []byte(b.String()), nil
+}
+
+// writeJSONL writes each row of `t` as a JSON object on its own line
+func writeJSONL(w io.Writer, t *outputTable) error {
+	writer := bufio.NewWriter(w)
+	for _, row := range t.rows {
+		line, err := jsonRow(t, row, false)
+		if err != nil {
+			return err
+		}
+		writer.Write(line)
+		writer.WriteString("\n")
+	}
+
+	return writer.Flush()
+}
+
+// parquetSchema returns the schema of `t` as used by the parquet-go JSON writer.
+// Floats and dates are optional so that missing values are written as nulls.
+func parquetSchema(t *outputTable) (string, error) {
+	type field struct {
+		Tag    string   `json:"Tag"`
+		Fields []*field `json:"Fields,omitempty"`
+	}
+
+	root := &field{Tag: "name=parquet_go_root, repetitiontype=REQUIRED"}
+	for _, c := range t.columns {
+		f := &field{}
+		switch c.typ {
+		case typeString:
+			f.Tag = "type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REQUIRED"
+		case typeInt:
+			f.Tag = "type=INT64, repetitiontype=REQUIRED"
+		case typeFloat:
+			f.Tag = "type=DOUBLE, repetitiontype=OPTIONAL"
+		case typeDate:
+			f.Tag = "type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"
+		case typeList:
+			f.Tag = "type=LIST, repetitiontype=REQUIRED"
+			f.Fields = []*field{{Tag: "name=element, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REQUIRED"}}
+		}
+		f.Tag = fmt.Sprintf("name=%s, %s", c.name, f.Tag)
+		root.Fields = append(root.Fields, f)
+	}
+
+	schema, err := json.Marshal(root)
+	return string(schema), err
+}
+
+// writeParquet writes the rows of `t` as a Parquet file
+func writeParquet(w io.Writer, t *outputTable) error {
+	schema, err := parquetSchema(t)
+	if err != nil {
+		return err
+	}
+
+	pw, err := writer.NewJSONWriter(schema, writerfile.NewWriterFile(w), 1)
+	if err != nil {
+		return fmt.Errorf("could not create Parquet writer: %v", err)
+	}
+
+	for _, row := range t.rows {
+		record, err := jsonRow(t, row, true)
+		if err != nil {
+			return err
+		}
+		if err := pw.Write(string(record)); err != nil {
+			return fmt.Errorf("could not write Parquet row: %v", err)
+		}
+	}
+
+	return pw.WriteStop()
+}
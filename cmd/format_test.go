@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_writeCombinedFormats(t *testing.T) {
+	data := []*combinedData{
+		{
+			id: "2", title: "Missing", score: 0.25,
+		},
+		{
+			id: "1", title: "Toy Story", url: "https://en.wikipedia.org/wiki/Toy_Story", abstract: "Toy Story is a film",
+			score: 0.5, budget: 30000000, year: time.Date(1995, 10, 30, 0, 0, 0, 0, time.UTC), revenue: 373554033,
+			ratio: float32Ptr(12.451801), rating: float32Ptr(3.5), ratingMedian: float32Ptr(3.5), weightedRating: float32Ptr(3.25), ratingCount: 2, productionCompanies: []string{"Pixar", "Disney"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		expected string
+	}{
+		{
+			name:   "csv",
+			format: formatCSV,
+			expected: "id,title,url,abstract,score,budget,year,revenue,ratio,rating,rating_median,weighted_rating,rating_count,production_companies\n" +
+				"1,Toy Story,https://en.wikipedia.org/wiki/Toy_Story,Toy Story is a film,0.500000,30000000,1995-10-30,373554033,12.451801,3.500000,3.500000,3.250000,2,Pixar;Disney\n" +
+				"2,Missing,,,0.250000,0,,0,,,,,0,\n",
+		},
+		{
+			name:   "jsonl",
+			format: formatJSONL,
+			expected: `{"id":"1","title":"Toy Story","url":"https://en.wikipedia.org/wiki/Toy_Story","abstract":"Toy Story is a film","score":0.5,"budget":30000000,"year":"1995-10-30","revenue":373554033,"ratio":12.451801,"rating":3.5,"rating_median":3.5,"weighted_rating":3.25,"rating_count":2,"production_companies":["Pixar","Disney"]}` + "\n" +
+				`{"id":"2","title":"Missing","url":"","abstract":"","score":0.25,"budget":0,"year":null,"revenue":0,"ratio":null,"rating":null,"rating_median":null,"weighted_rating":null,"rating_count":0,"production_companies":[]}` + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, writeCombined(&buf, data, test.format, defaultSortOrder))
+			require.Equal(t, test.expected, buf.String())
+		})
+	}
+
+	// Missing values are read back from empty CSV cells, as well as NaN written by previous versions
+	in := "id,title,year,budget,revenue,ratio,rating,score\n" +
+		"2,Missing,,0,0,,NaN,0.25\n"
+	res := make(map[string]*combinedData)
+	stats := makeStats("combined.csv")
+	columns := csvColumns{required: []string{"id", "title", "year", "budget", "revenue", "ratio", "rating", "score"}}
+	require.NoError(t, readCSV(csv.NewReader(strings.NewReader(in)), stats, columns, nil, readCombinedData(res)))
+	require.Empty(t, stats.rowErrors)
+	require.Equal(t, data[0], res["2"])
+}
+
+func Test_listRoundTrip(t *testing.T) {
+	tests := [][]string{
+		{"Pixar", "Disney"},
+		{"Studio; Ltd.", "Back\\slash", "Trailing\\"},
+		{""},
+	}
+
+	for _, companies := range tests {
+		var buf bytes.Buffer
+		data := []*combinedData{{id: "1", title: "Toy Story", productionCompanies: companies}}
+		require.NoError(t, writeCombined(&buf, data, formatCSV, defaultSortOrder))
+
+		res := make(map[string]*combinedData)
+		stats := makeStats("combined.csv")
+		columns := csvColumns{required: []string{"id", "production_companies"}}
+		require.NoError(t, readCSV(csv.NewReader(&buf), stats, columns, nil, readCombinedData(res)))
+		require.Empty(t, stats.rowErrors)
+		require.Equal(t, companies, res["1"].productionCompanies)
+	}
+
+	require.Equal(t, `Studio\; Ltd.;Disney`, joinList([]string{"Studio; Ltd.", "Disney"}))
+	require.Equal(t, []string{"Pixar", "Disney"}, splitList("Pixar;Disney"))
+}
+
+func Test_writeRatios(t *testing.T) {
+	metadata := moviesMetadata{
+		"1": &movieMetadata{budget: 30000000, revenue: 373554033},
+		"2": &movieMetadata{budget: 100, revenue: 1234567891},
+	}
+	ratios, _ := metadata.ratios()
+
+	// Ratios are written in full precision, which a float32 would round to 12345679
+	var buf bytes.Buffer
+	require.NoError(t, writeRatios(&buf, ratios, formatCSV, defaultSortOrder))
+	require.Equal(t, "id,ratio\n1,12.451801\n2,12345678.910000\n", buf.String())
+
+	res := make(moviesRatios)
+	stats := makeStats("ratios.csv")
+	require.NoError(t, readCSV(csv.NewReader(&buf), stats, csvColumns{required: []string{"id", "ratio"}}, nil, readMoviesRatio(res)))
+	require.Empty(t, stats.rowErrors)
+	require.Equal(t, 12345678.91, res["2"])
+}
+
+func Test_parquetSchema(t *testing.T) {
+	schema, err := parquetSchema(&outputTable{columns: []outputColumn{
+		{"id", typeString}, {"budget", typeInt}, {"ratio", typeFloat}, {"year", typeDate}, {"production_companies", typeList},
+	}})
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"Tag": "name=parquet_go_root, repetitiontype=REQUIRED",
+		"Fields": [
+			{"Tag": "name=id, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REQUIRED"},
+			{"Tag": "name=budget, type=INT64, repetitiontype=REQUIRED"},
+			{"Tag": "name=ratio, type=DOUBLE, repetitiontype=OPTIONAL"},
+			{"Tag": "name=year, type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"},
+			{"Tag": "name=production_companies, type=LIST, repetitiontype=REQUIRED", "Fields": [
+				{"Tag": "name=element, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REQUIRED"}
+			]}
+		]
+	}`, schema)
+
+	// Dates are written to Parquet files as days since the epoch
+	row, err := jsonRow(&outputTable{columns: []outputColumn{{"year", typeDate}}}, []interface{}{time.Date(1970, 1, 11, 0, 0, 0, 0, time.UTC)}, true)
+	require.NoError(t, err)
+	require.Equal(t, `{"year":10}`, string(row))
+}
+
+func Test_formatOutputPath(t *testing.T) {
+	require.NoError(t, checkOutputFormat(formatParquet))
+	require.Error(t, checkOutputFormat("xlsx"))
+
+	require.Equal(t, "output_combine.jsonl", formatOutputPath("output_combine.csv", formatJSONL))
+	require.Equal(t, "output_combine.parquet", formatOutputPath("output_combine.csv", formatParquet))
+	require.Equal(t, "-", formatOutputPath("-", formatParquet))
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zipMagic   = []byte("PK\x03\x04")
+)
+
+// inputFile is the decompressed contents of an input file
+type inputFile struct {
+	io.Reader
+	// name identifies the input, including the archive member if read from a zip archive
+	name    string
+	closers []io.Closer
+}
+
+// Close closes the decompressors and the underlying file
+func (f *inputFile) Close() error {
+	var err error
+	for i := len(f.closers) - 1; i >= 0; i-- {
+		if closeErr := f.closers[i].Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// openInput opens the file at `path` for reading. The compression used by the file is detected from
+// its first bytes, and gzip and bzip2 files are decompressed as they are read.
+// For zip archives, the file called `member` is read from the archive. If `member` is empty then the
+// archive must only contain a single file.
+func openInput(path, member string) (*inputFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file at %q: %v", path, err)
+	}
+	in := &inputFile{name: path, closers: []io.Closer{file}}
+
+	buffered := bufio.NewReader(file)
+	// Errors are ignored as files shorter than the magic bytes are treated as uncompressed
+	header, _ := buffered.Peek(len(zipMagic))
+
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		reader, err := gzip.NewReader(buffered)
+		if err != nil {
+			in.Close()
+			return nil, fmt.Errorf("could not decompress gzip file at %q: %v", path, err)
+		}
+		in.Reader = reader
+		in.closers = append(in.closers, reader)
+	case bytes.HasPrefix(header, bzip2Magic):
+		in.Reader = bzip2.NewReader(buffered)
+	case bytes.HasPrefix(header, zipMagic):
+		reader, name, err := openZipMember(file, member)
+		if err != nil {
+			in.Close()
+			return nil, fmt.Errorf("could not read zip archive at %q: %v", path, err)
+		}
+		in.Reader = reader
+		in.name = path + ":" + name
+		in.closers = append(in.closers, reader)
+	default:
+		in.Reader = buffered
+	}
+
+	return in, nil
+}
+
+// openZipMember opens the file called `name` inside a zip archive.
+// Directories inside the archive are ignored when comparing names.
+// The name of the opened file within the archive is also returned.
+func openZipMember(file *os.File, name string) (io.ReadCloser, string, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, "", err
+	}
+
+	archive, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return nil, "", err
+	}
+
+	files := []*zip.File{}
+	for _, f := range archive.File {
+		if !f.FileInfo().IsDir() {
+			files = append(files, f)
+		}
+	}
+
+	if name == "" {
+		if len(files) != 1 {
+			return nil, "", fmt.Errorf("archive contains %d files when exactly 1 is expected", len(files))
+		}
+		reader, err := files[0].Open()
+		return reader, files[0].Name, err
+	}
+
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		if path.Base(f.Name) == name {
+			reader, err := f.Open()
+			return reader, f.Name, err
+		}
+		names = append(names, f.Name)
+	}
+
+	return nil, "", fmt.Errorf("could not find %q in archive containing %s", name, strings.Join(names, ", "))
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const inputContents = "id,ratio\n1,2.500000\n"
+
+func Test_openInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []byte
+		member  string
+		wantErr bool
+	}{
+		{
+			name: "uncompressed",
+			in:   []byte(inputContents),
+		},
+		{
+			name: "empty",
+			in:   []byte{},
+		},
+		{
+			name: "gzip",
+			in:   gzipBytes(t, inputContents),
+		},
+		{
+			name: "bzip2",
+			// bzip2 compressed `inputContents`
+			in: []byte{66, 90, 104, 57, 49, 65, 89, 38, 83, 89, 61, 127, 216, 41, 0, 0, 7, 217, 128, 32, 16, 0, 5, 114, 0, 36, 32, 148, 0, 32, 0, 34, 0, 0, 16, 0, 1, 112, 222, 229, 134, 162, 107, 117, 120, 219, 188, 93, 201, 20, 225, 66, 64, 245, 255, 96, 164},
+		},
+		{
+			name:   "zip member",
+			in:     zipBytes(t, map[string]string{"dataset/ratios.csv": inputContents, "dataset/other.csv": "other"}),
+			member: "ratios.csv",
+		},
+		{
+			name: "zip single file",
+			in:   zipBytes(t, map[string]string{"ratios.csv": inputContents}),
+		},
+		{
+			name:    "zip missing member",
+			in:      zipBytes(t, map[string]string{"ratios.csv": inputContents}),
+			member:  "credits.csv",
+			wantErr: true,
+		},
+		{
+			name:    "zip multiple files without member",
+			in:      zipBytes(t, map[string]string{"ratios.csv": inputContents, "other.csv": "other"}),
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "input")
+			require.NoError(t, ioutil.WriteFile(path, test.in, 0644))
+
+			in, err := openInput(path, test.member)
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer in.Close()
+
+			out, err := ioutil.ReadAll(in)
+			require.NoError(t, err)
+			if len(test.in) == 0 {
+				require.Empty(t, out)
+			} else {
+				require.Equal(t, inputContents, string(out))
+			}
+		})
+	}
+}
+
+func gzipBytes(t *testing.T, s string) []byte {
+	buf := new(bytes.Buffer)
+	w := gzip.NewWriter(buf)
+	_, err := w.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func zipBytes(t *testing.T, files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for name, contents := range files {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
@@ -1,13 +1,10 @@
 package cmd
 
 import (
-	"bufio"
 	"database/sql"
-	"encoding/csv"
 	"fmt"
-	"math"
-	"os"
-	"sort"
+	"strings"
+	"time"
 
 	"github.com/lib/pq"
 	_ "github.com/lib/pq"
@@ -16,111 +13,250 @@ import (
 
 var (
 	loadCmd = &cobra.Command{
-		Use:   "load <combined.csv> <connection_uri>",
-		Short: "Loads the data to a Postgres database",
+		Use:   "load <combined.csv> <database_uri>",
+		Short: "Loads the data to a Postgres or SQLite database",
 		RunE:  load,
 		Args:  cobra.MinimumNArgs(2),
 	}
 
-	dropTableStmt = `
-DROP TABLE IF EXISTS topmovies;
+	// Rows are loaded to staging tables, which are dropped once loaded, before being moved to their tables
+	createTempTableStmt = `
+CREATE TEMP TABLE %[1]s_staging (LIKE %[1]s INCLUDING ALL) ON COMMIT DROP;
 `
 
-	createTableStmt = `
-CREATE TABLE IF NOT EXISTS topmovies (
-	id INTEGER PRIMARY KEY,
-	title TEXT,
-	year DATE,
-	rating REAL,
-	budget BIGINT,
-	revenue BIGINT,
-	ratio REAL,
-	production_companies TEXT[],
-	url TEXT,
-	abstract TEXT
-);`
-
-	columns = []string{"id", "title", "year", "rating", "budget", "revenue", "ratio", "production_companies", "url", "abstract"}
+	deleteMissingStmt = `
+DELETE FROM %[1]s WHERE id NOT IN (SELECT id FROM %[1]s_staging);
+`
+
+	columns = []string{"id", "rank", "title", "year", "rating", "budget", "revenue", "ratio", "production_companies", "url", "abstract",
+		"rating_count", "rating_median", "weighted_rating"}
+
+	loadMode      string
+	deleteMissing bool
+	rankBy        string
+	loadLimit     int
+	minBudget     int
+	minVotes      int
+	loadSchema    string
+	metadataFile  string
+	creditsFile   string
+)
+
+const (
+	// loadReplace replaces all rows of the table
+	loadReplace = "replace"
+	// loadUpsert inserts new rows and updates existing rows with the same id
+	loadUpsert = "upsert"
+	// loadAppend inserts new rows, leaving existing rows with the same id unchanged
+	loadAppend = "append"
 )
 
+const (
+	// schemaFlat loads movies to the `topmovies` table
+	schemaFlat = "flat"
+	// schemaNormalised loads movies along with their companies and credits to separate tables
+	schemaNormalised = "normalised"
+)
+
+func init() {
+	addLoadFlags(loadCmd)
+	loadCmd.Flags().StringVar(&metadataFile, "metadata-file", "", "movies metadata file the production companies are read from, for the normalised schema")
+	loadCmd.Flags().StringVar(&creditsFile, "credits-file", "", "credits file the cast and crew are read from, for the normalised schema")
+}
+
+// addLoadFlags adds the flags controlling how data is loaded to a command
+func addLoadFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&loadMode, "mode", loadReplace, "how rows are loaded to the table, one of replace, upsert or append")
+	cmd.Flags().BoolVar(&deleteMissing, "delete-missing", false, "delete rows of the table which are not loaded, in upsert mode")
+	cmd.Flags().StringVar(&rankBy, "rank-by", "ratio", "value movies are ranked by, one of ratio, rating, weighted_rating, revenue or budget, or a weighted sum such as 0.7*ratio+0.3*rating")
+	cmd.Flags().IntVar(&loadLimit, "limit", 0, "maximum number of movies to load, in order of rank, or 0 to load all movies")
+	cmd.Flags().IntVar(&minBudget, "min-budget", 0, "only load movies with at least this budget")
+	cmd.Flags().IntVar(&minVotes, "min-votes", 0, "only load movies with at least this number of ratings")
+	cmd.Flags().StringVar(&loadSchema, "schema", schemaFlat, "schema movies are loaded to, either flat for the topmovies table or normalised for separate tables of movies, companies and people")
+}
+
 func load(cmd *cobra.Command, args []string) error {
-	// Open combined data file
-	data, err := os.Open(args[0])
-	if err != nil {
-		return err
+	if loadSchema == schemaNormalised && (metadataFile == "" || creditsFile == "") {
+		return fmt.Errorf("the --metadata-file and --credits-file flags are required to load the %s schema", schemaNormalised)
 	}
-	defer data.Close()
 
-	stats := makeStats(args[0])
+	// Read combined data file
 	res := make(map[string]*combinedData)
-	err = readCSV(
-		csv.NewReader(bufio.NewReader(data)),
-		stats,
-		columns,
+	err := readCSVFile(
+		args[0],
+		nil,
+		csvColumns{
+			required: []string{"id", "title", "year", "rating", "budget", "revenue", "ratio", "production_companies", "url", "abstract"},
+			optional: []string{"rating_count", "rating_median", "weighted_rating"},
+		},
 		readCombinedData(res),
 	)
 	if err != nil {
 		return err
 	}
 
-	fmt.Print(stats)
-
 	combinedData := make([]*combinedData, 0, len(res))
 	for _, d := range res {
 		combinedData = append(combinedData, d)
 	}
 
-	sort.Slice(combinedData, func(i, j int) bool {
-		// Return true if the value in index i is greater than value in index j
-		ratioI := float64(combinedData[i].ratio)
-		if math.IsNaN(ratioI) {
-			return false
+	var relations *movieRelations
+	if loadSchema == schemaNormalised {
+		relations = newMovieRelations()
+		err = readCSVFile(
+			metadataFile,
+			metadataDataset,
+			csvColumns{required: []string{"id", "production_companies"}},
+			readMovieCompanies(relations),
+		)
+		if err != nil {
+			return err
 		}
-		ratioJ := float64(combinedData[j].ratio)
-		if math.IsNaN(ratioJ) {
-			return true
+
+		err = readCSVFile(
+			creditsFile,
+			creditsDataset,
+			csvColumns{required: []string{"id", "cast", "crew"}},
+			readMovieCredits(relations),
+		)
+		if err != nil {
+			return err
 		}
+	}
 
-		return ratioI > ratioJ
-	})
+	return loadCombined(combinedData, relations, args[1])
+}
 
-	// Create a database connection
-	db, err := connect(args[1])
+// loadCombined ranks the movies and loads them to the database at `url`.
+// The `relations` of the movies are only used by the normalised schema.
+func loadCombined(combinedData []*combinedData, relations *movieRelations, url string) error {
+	if loadMode != loadReplace && loadMode != loadUpsert && loadMode != loadAppend {
+		return fmt.Errorf("unknown load mode %q, expected one of %s, %s or %s", loadMode, loadReplace, loadUpsert, loadAppend)
+	}
+	if loadSchema != schemaFlat && loadSchema != schemaNormalised {
+		return fmt.Errorf("unknown schema %q, expected one of %s or %s", loadSchema, schemaFlat, schemaNormalised)
+	}
+	if loadLimit < 0 {
+		return fmt.Errorf("limit has value %d when a positive number or 0 for no limit is expected", loadLimit)
+	}
+
+	expr, err := parseRankExpr(rankBy)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
+	combinedData = rankMovies(combinedData, rankOptions{
+		expr:      expr,
+		minBudget: minBudget,
+		minVotes:  minVotes,
+		limit:     loadLimit,
+	})
 
-	tx, err := db.Begin()
+	s, err := openSink(url)
 	if err != nil {
 		return err
 	}
+	defer s.Close()
 
-	// Delete existing table
-	if _, err := tx.Exec(dropTableStmt); err != nil {
+	// The tables are created and changed by the migrate command
+	if err := checkSchema(s); err != nil {
 		return err
 	}
 
-	// Create table (including any schema changes)
-	if _, err := tx.Exec(createTableStmt); err != nil {
+	inserted, updated, deleted, err := s.load(combinedData, relations)
+	if err != nil {
 		return err
 	}
 
-	stmt, err := tx.Prepare(pq.CopyIn("topmovies", columns...))
+	fmt.Fprintf(logOutput, "Loaded data in %s mode: %d rows inserted, %d rows updated, %d rows deleted\n", loadMode, inserted, updated, deleted)
+	return nil
+}
+
+// loadFlat loads the ranked movies to the `topmovies` table.
+// It returns the number of movies inserted, updated and deleted.
+func loadFlat(tx *sql.Tx, combinedData []*combinedData) (int64, int64, int64, error) {
+	var inserted, updated, deleted int64
+
+	if _, err := tx.Exec(fmt.Sprintf(createTempTableStmt, "topmovies")); err != nil {
+		return 0, 0, 0, err
+	}
+
+	if err := copyRows(tx, "topmovies_staging", combinedData); err != nil {
+		return 0, 0, 0, err
+	}
+
+	switch loadMode {
+	case loadReplace:
+		// Rows are deleted rather than the table being dropped or truncated so that the views and grants depending
+		// on it are kept, and so that readers are not blocked but see the previous rows until the transaction commits
+		if _, err := tx.Exec("DELETE FROM topmovies"); err != nil {
+			return 0, 0, 0, err
+		}
+		res, err := tx.Exec(insertStagingStmt("topmovies", columns))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if inserted, err = res.RowsAffected(); err != nil {
+			return 0, 0, 0, err
+		}
+	case loadUpsert:
+		if err := tx.QueryRow(upsertStmt("topmovies", columns)).Scan(&inserted, &updated); err != nil {
+			return 0, 0, 0, err
+		}
+		if deleteMissing {
+			res, err := tx.Exec(fmt.Sprintf(deleteMissingStmt, "topmovies"))
+			if err != nil {
+				return 0, 0, 0, err
+			}
+			if deleted, err = res.RowsAffected(); err != nil {
+				return 0, 0, 0, err
+			}
+		}
+	case loadAppend:
+		res, err := tx.Exec(appendStmt("topmovies", columns))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if inserted, err = res.RowsAffected(); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	return inserted, updated, deleted, nil
+}
+
+// copyRows adds the ranked movies to `table`
+func copyRows(tx *sql.Tx, table string, combinedData []*combinedData) error {
+	return copyIn(tx, table, columns, flatRows(combinedData))
+}
+
+// flatRows returns the rows of the `topmovies` table for the ranked movies, with the first movie given rank 1
+func flatRows(combinedData []*combinedData) [][]interface{} {
+	rows := make([][]interface{}, 0, len(combinedData))
+	for i, datum := range combinedData {
+		rows = append(rows, []interface{}{datum.id, i + 1, datum.title, datum.year, datum.rating, datum.budget, datum.revenue, datum.ratio, datum.productionCompanies, datum.url, datum.abstract,
+			datum.ratingCount, datum.ratingMedian, datum.weightedRating})
+	}
+	return rows
+}
+
+// copyIn adds rows to `table`, with the values of each row given in the order of `columns`
+func copyIn(tx *sql.Tx, table string, columns []string, rows [][]interface{}) error {
+	stmt, err := tx.Prepare(pq.CopyIn(table, columns...))
 	if err != nil {
 		return err
 	}
 
 	// Add data to table
-	for i, datum := range combinedData {
-		if i >= 1000 {
-			break
+	for _, row := range rows {
+		values := make([]interface{}, len(row))
+		for i, v := range row {
+			values[i] = postgresValue(v)
 		}
 
-		_, err = stmt.Exec(datum.id, datum.title, datum.year, datum.rating, datum.budget, datum.revenue, datum.ratio, pq.Array(datum.productionCompanies), datum.url, datum.abstract)
+		_, err = stmt.Exec(values...)
 		if err != nil {
 			if verboseErrors {
-				fmt.Printf("error adding row to table: %v\n", err)
+				fmt.Fprintf(logOutput, "error adding row to table: %v\n", err)
 			}
 			continue
 		}
@@ -128,18 +264,74 @@ func load(cmd *cobra.Command, args []string) error {
 
 	// Flush buffer
 	if _, err := stmt.Exec(); err != nil {
-		return fmt.Errorf("could not flush data: %v", err)
+		return fmt.Errorf("could not flush data to %s: %v", table, err)
 	}
 
-	if err := stmt.Close(); err != nil {
-		return err
+	return stmt.Close()
+}
+
+// postgresValue converts lists to Postgres arrays and missing values to NULL
+func postgresValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []string:
+		return pq.Array(v)
+	case *float32:
+		if v == nil {
+			return nil
+		}
+		return float64(*v)
+	case time.Time:
+		if v.IsZero() {
+			return nil
+		}
 	}
+	return v
+}
 
-	if err := tx.Commit(); err != nil {
-		return err
+// upsertStmt returns the statement inserting new rows from the staging table of `table` and updating rows which
+// have changed, where the first column is the id. The statement returns the number of inserted and updated rows.
+func upsertStmt(table string, columns []string) string {
+	// Rows which are inserted have no previous version, which is given by `xmax = 0`
+	return fmt.Sprintf(`
+WITH upserted AS (%s
+	RETURNING (xmax = 0) AS inserted
+)
+SELECT COUNT(*) FILTER (WHERE inserted), COUNT(*) FILTER (WHERE NOT inserted) FROM upserted;
+`, upsertInsertStmt(table, columns))
+}
+
+// upsertInsertStmt returns the insert statement of `upsertStmt`, which is supported by both Postgres and SQLite
+func upsertInsertStmt(table string, columns []string) string {
+	updates := make([]string, 0, len(columns)-1)
+	current := make([]string, 0, len(columns)-1)
+	excluded := make([]string, 0, len(columns)-1)
+	for _, column := range columns[1:] {
+		updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", column, column))
+		current = append(current, table+"."+column)
+		excluded = append(excluded, "EXCLUDED."+column)
 	}
 
-	return nil
+	// SQLite needs a WHERE clause to tell the ON CONFLICT clause apart from a join constraint
+	return fmt.Sprintf(`
+	INSERT INTO %[1]s (%[2]s)
+	SELECT %[2]s FROM %[1]s_staging WHERE true
+	ON CONFLICT (%[3]s) DO UPDATE SET %[4]s
+	WHERE (%[5]s) IS DISTINCT FROM (%[6]s)`,
+		table, strings.Join(columns, ", "), columns[0], strings.Join(updates, ", "), strings.Join(current, ", "), strings.Join(excluded, ", "))
+}
+
+// insertStagingStmt returns the statement inserting all rows from the staging table of `table`
+func insertStagingStmt(table string, columns []string) string {
+	return fmt.Sprintf("INSERT INTO %[1]s (%[2]s) SELECT %[2]s FROM %[1]s_staging", table, strings.Join(columns, ", "))
+}
+
+// appendStmt returns the statement inserting rows from the staging table of `table` which are not already in the table
+func appendStmt(table string, columns []string) string {
+	return fmt.Sprintf(`
+INSERT INTO %[1]s (%[2]s)
+SELECT %[2]s FROM %[1]s_staging WHERE true
+ON CONFLICT DO NOTHING;
+`, table, strings.Join(columns, ", "))
 }
 
 func connect(url string) (*sql.DB, error) {
@@ -153,6 +345,6 @@ func connect(url string) (*sql.DB, error) {
 		return nil, err
 	}
 
-	fmt.Println("Successfully connected to Postgres!")
+	fmt.Fprintln(logOutput, "Successfully connected to Postgres!")
 	return db, nil
 }
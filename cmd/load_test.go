@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_upsertStmt(t *testing.T) {
+	stmt := upsertStmt("topmovies", columns)
+
+	require.Contains(t, stmt, "INSERT INTO topmovies (id, rank, title, year, rating, budget, revenue, ratio, production_companies, url, abstract, rating_count, rating_median, weighted_rating)")
+	require.Contains(t, stmt, "ON CONFLICT (id) DO UPDATE SET rank = EXCLUDED.rank, title = EXCLUDED.title, year = EXCLUDED.year")
+	// The id is the conflict key so is never updated
+	require.NotContains(t, stmt, "id = EXCLUDED.id")
+	require.Contains(t, stmt, "WHERE (topmovies.rank, topmovies.title, topmovies.year, topmovies.rating")
+
+	stmt = upsertStmt("companies", companyColumns)
+	require.Contains(t, stmt, "SELECT id, name FROM companies_staging")
+	require.Contains(t, stmt, "ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name")
+	require.Contains(t, stmt, "WHERE (companies.name) IS DISTINCT FROM (EXCLUDED.name)")
+}
+
+func Test_insertStagingStmt(t *testing.T) {
+	require.Equal(t, "INSERT INTO companies (id, name) SELECT id, name FROM companies_staging", insertStagingStmt("companies", companyColumns))
+}
+
+func Test_loadCombinedMode(t *testing.T) {
+	defer func() { loadMode = loadReplace }()
+
+	// The mode is checked before connecting to the database
+	loadMode = "merge"
+	err := loadCombined(nil, nil, "postgres://localhost:1/topmovies")
+	require.EqualError(t, err, `unknown load mode "merge", expected one of replace, upsert or append`)
+	loadMode = loadReplace
+
+	defer func() { rankBy = "ratio" }()
+	rankBy = "title"
+	err = loadCombined(nil, nil, "postgres://localhost:1/topmovies")
+	require.EqualError(t, err, `rank expression "title" has unknown value "title", expected one of ratio, rating, weighted_rating, revenue or budget`)
+	rankBy = "ratio"
+
+	defer func() { loadSchema = schemaFlat }()
+	loadSchema = "star"
+	err = loadCombined(nil, nil, "postgres://localhost:1/topmovies")
+	require.EqualError(t, err, `unknown schema "star", expected one of flat or normalised`)
+}
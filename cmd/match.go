@@ -1,193 +1,334 @@
 package cmd
 
 import (
-	"bufio"
-	"encoding/csv"
 	"encoding/xml"
 	"fmt"
-	"os"
+	"io"
+	"math"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"unicode/utf8"
 
-	"github.com/dghubble/trie"
 	"github.com/spf13/cobra"
 )
 
 var (
 	matchCmd = &cobra.Command{
-		Use:   "match <wiki.xml> <movies_metadata.csv> <movies_credits.csv>",
+		Use:   "match <wiki.xml[.gz|.bz2]> <movies_metadata.csv> <movies_credits.csv>",
 		Short: "Match movies in the IMDB dataset with its corresponding Wikipedia page",
 		RunE:  match,
 		Args:  cobra.ExactArgs(3),
 	}
+
+	matchOutput      string
+	matchSortBy      string
+	matchFormat      string
+	matchWorkers     int
+	allowPartial     bool
+	maxTitleDistance int
+	normaliseFlag    []string
+	yearTolerance    int
 )
 
-func match(cmd *cobra.Command, args []string) error {
-	// Read Wiki file
-	wikiPath := args[0]
-	wikiFile, err := os.Open(wikiPath)
+func init() {
+	matchCmd.Flags().StringVarP(&matchOutput, "output", "o", "output_matching.csv", "output file, or - for stdout")
+	matchCmd.Flags().StringVar(&matchSortBy, "sort-by", "id", "output column to sort by, followed by :asc or :desc for the direction")
+	matchCmd.Flags().StringVar(&matchFormat, "format", formatCSV, "output format, one of csv, jsonl or parquet")
+	matchCmd.Flags().IntVar(&matchWorkers, "workers", runtime.NumCPU(), "number of goroutines matching Wikipedia entries")
+	matchCmd.Flags().BoolVar(&allowPartial, "allow-partial", false, "keep the entries matched before an error reading the Wikipedia dataset")
+	addMatchFlags(matchCmd)
+}
+
+// addMatchFlags adds the flags controlling how movies are matched to a command
+func addMatchFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&maxTitleDistance, "max-title-distance", 0, "maximum number of edits between the title of a movie and a Wikipedia title for the movie to be a candidate, or 0 for exact titles only")
+	cmd.Flags().IntVar(&yearTolerance, "year-tolerance", 1, "number of years a release year given by a Wikipedia entry can differ from the release year of a movie and still add to its score")
+	cmd.Flags().StringSliceVar(&normaliseFlag, "normalise", normaliseSteps, "steps normalising titles and abstracts before matching, any of fold, and, articles, punctuation and numerals, or none")
+	addScoringFlags(cmd)
+}
+
+// configureMatching loads the scoring config given by the flags added by `addMatchFlags` and sets the normaliser
+// used for matching. The scoring config is written to the log so that the matches can be reproduced.
+func configureMatching(cmd *cobra.Command) error {
+	config, err := loadScoringConfig(cmd)
 	if err != nil {
 		return err
 	}
-	defer wikiFile.Close()
 
-	wikiDecoder := xml.NewDecoder(wikiFile)
-	movieEntries := make(chan *wikiEntry, 1000)
+	n, err := newNormaliser(config.Normalise)
+	if err != nil {
+		return err
+	}
+	textNormaliser = n
+	// The steps are written in the order they are applied, with no steps for "none"
+	config.Normalise = append([]string{}, n.steps...)
+	matchScoring = config
 
-	// Asynchronously read Wikipedia data
-	go func() {
-		if err := readWiki(wikiDecoder, movieEntries); err != nil {
-			fmt.Printf("error reading wiki dataset: %v", err)
-		}
-	}()
+	fmt.Fprintln(logOutput, "Scoring matches with:")
+	return matchScoring.write(logOutput)
+}
 
-	// Read movies metadata dataset
-	metadataPath := args[1]
-	metadataFile, err := os.Open(metadataPath)
+func match(cmd *cobra.Command, args []string) error {
+	order, err := outputSortOrder(matchSortBy, columnNames(matchColumns))
 	if err != nil {
 		return err
 	}
-	defer metadataFile.Close()
+	if err := checkOutputFormat(matchFormat); err != nil {
+		return err
+	}
+	if err := configureMatching(cmd); err != nil {
+		return err
+	}
+	if !cmd.Flags().Changed("output") {
+		matchOutput = formatOutputPath(matchOutput, matchFormat)
+	}
 
-	moviesMetadataStats := makeStats(metadataPath)
-	moviesMetadata := make(moviesMetadata)
-	err = readCSV(
-		csv.NewReader(bufio.NewReader(metadataFile)),
-		moviesMetadataStats,
-		[]string{"id", "title", "release_date", "production_companies", "original_title"},
-		readMoviesMetadata(moviesMetadata),
-	)
+	// Read Wiki file
+	wikiPath := args[0]
+	wikiFile, err := openInput(wikiPath, "")
 	if err != nil {
 		return err
 	}
+	defer wikiFile.Close()
 
-	fmt.Print(moviesMetadataStats)
+	// Asynchronously read Wikipedia data
+	movieEntries, wikiErr := readWikiAsync(xml.NewDecoder(wikiFile))
 
-	// Read movies credits dataset
-	creditsPath := args[2]
-	creditsFile, err := os.Open(creditsPath)
+	// Read movies metadata dataset
+	moviesMetadata := make(moviesMetadata)
+	err = readCSVFile(
+		args[1],
+		metadataDataset,
+		csvColumns{
+			required: []string{"id", "title"},
+			optional: []string{"release_date", "production_companies", "original_title"},
+		},
+		readMoviesMetadata(moviesMetadata),
+	)
 	if err != nil {
 		return err
 	}
-	defer creditsFile.Close()
 
-	moviesCreditsStats := makeStats(creditsPath)
+	// Read movies credits dataset
 	moviesCredits := make(moviesCredits)
-	err = readCSV(
-		csv.NewReader(bufio.NewReader(creditsFile)),
-		moviesCreditsStats,
-		[]string{"id", "crew", "cast"},
+	err = readCSVFile(
+		args[2],
+		creditsDataset,
+		csvColumns{required: []string{"id", "crew", "cast"}},
 		readMoviesCredits(moviesCredits),
 	)
 	if err != nil {
 		return err
 	}
 
-	fmt.Print(moviesCreditsStats)
+	results := matchMovies(movieEntries, moviesMetadata, moviesCredits, matchWorkers)
+	if err := checkWikiErr(<-wikiErr, results); err != nil {
+		return err
+	}
 
-	// Intialise features from movies datasets
-	features := []matching{
-		moviesMetadata.features(),
-		moviesCredits.features(),
+	if err := writeFile(matchOutput, func(w io.Writer) error { return writeMatches(w, results, matchFormat, order) }); err != nil {
+		return err
 	}
 
-	results := map[string]*matchResult{}
-	for entry := range movieEntries {
-		mostRelevantIDs := []string{}
+	// The scoring config is written along with the matches, which are reproduced by passing it to --scoring-file
+	if matchOutput == stdoutPath {
+		return nil
+	}
+	return writeFile(scoringFilePath(matchOutput), matchScoring.write)
+}
 
-		normalisedEntry := &wikiEntry{
-			title:    normaliseString(entry.title),
-			abstract: normaliseString(entry.abstract),
+// matchMovies matches each Wikipedia entry received on `movieEntries` with the most relevant movie.
+// Entries are scored by `workers` goroutines and only the best scoring entry is kept for each movie id.
+func matchMovies(movieEntries <-chan *wikiEntry, moviesMetadata moviesMetadata, moviesCredits moviesCredits, workers int) matchResults {
+	// Intialise the enabled features from movies datasets
+	features := []weightedFeature{}
+	for _, name := range featureNames {
+		if !matchScoring.enabled(name) {
+			continue
 		}
 
-		// Load list of relevant movie IDs
-		for _, feature := range features {
-			mostRelevantIDs = append(mostRelevantIDs, feature.mostRelevant(normalisedEntry)...)
+		var feature matching
+		switch name {
+		case featureMetadata:
+			feature = moviesMetadata.features(matchScoring.MaxTitleDistance, matchScoring.TitleBias, !matchScoring.enabled(featureYear))
+		case featureCredits:
+			feature = moviesCredits.features()
+		case featureYear:
+			feature = moviesMetadata.yearFeatures(matchScoring.YearTolerance)
 		}
+		features = append(features, weightedFeature{matching: feature, weight: matchScoring.Weights[name]})
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
 
-		var maxScore float64
-		var bestID string
-		for _, id := range mostRelevantIDs {
-			var score float64
-			for _, feature := range features {
-				score += feature.relevance(normalisedEntry, id)
+	// Features are only read when scoring so they are shared between workers
+	scoredEntries := make(chan *scoredEntry, 1000)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range movieEntries {
+				if scored := scoreEntry(entry, features, matchScoring); scored != nil {
+					scoredEntries <- scored
+				}
 			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(scoredEntries)
+	}()
 
-			score = score / float64(len(features))
-			if score > maxScore {
-				bestID = id
-				maxScore = score
+	results := matchResults{}
+	for scored := range scoredEntries {
+		if results.add(scored.id, scored.result) {
+			// Output progress for information
+			if len(results)%1000 == 0 {
+				fmt.Fprintf(logOutput, "%d films matched\n", len(results))
 			}
 		}
+	}
+
+	fmt.Fprintf(logOutput, "A total of %d out of %d movies were matched with a Wikipedia entry\n", len(results), len(moviesMetadata))
+
+	return results
+}
+
+// checkWikiErr returns an error if the Wikipedia dataset could not be fully read, unless partial results are allowed
+func checkWikiErr(err error, results matchResults) error {
+	if err == nil {
+		return nil
+	}
+
+	if !allowPartial {
+		return fmt.Errorf("could not read Wikipedia dataset: %v", err)
+	}
+
+	fmt.Fprintf(logOutput, "WARNING: could not read Wikipedia dataset: %v\nKeeping the %d movies matched before the error\n", err, len(results))
+	return nil
+}
+
+// scoredEntry is a Wikipedia entry along with the movie it is most relevant to
+type scoredEntry struct {
+	id     string
+	result *matchResult
+}
 
-		if maxScore > 0 {
-			if currentRes, ok := results[bestID]; ok {
-				if currentRes.score > maxScore {
-					continue
+// scoreEntry returns the movie most relevant to a Wikipedia entry, or nil if no movie is relevant enough
+// to be accepted by `config`. The score of a movie is the weighted mean of the relevance of each feature.
+func scoreEntry(entry *wikiEntry, features []weightedFeature, config scoringConfig) *scoredEntry {
+	mostRelevant := []candidate{}
+
+	normalisedEntry := &wikiEntry{
+		title:    normaliseText(entry.lookupTitle()),
+		abstract: normaliseText(entry.abstract),
+		year:     entry.year,
+		country:  entry.country,
+	}
+
+	// Load list of relevant movies, keeping the smallest title distance of each movie
+	distances := make(map[string]int)
+	for _, feature := range features {
+		for _, c := range feature.mostRelevant(normalisedEntry) {
+			if d, ok := distances[c.id]; ok {
+				if c.distance < d {
+					distances[c.id] = c.distance
 				}
+				continue
 			}
-			results[bestID] = &matchResult{
-				score:    maxScore,
-				url:      entry.url,
-				abstract: entry.abstract,
-			}
+			distances[c.id] = c.distance
+			mostRelevant = append(mostRelevant, c)
+		}
+	}
 
-			// Output progress for information
-			if len(results)%1000 == 0 {
-				fmt.Printf("%d films matched\n", len(results))
+	var totalWeight float64
+	for _, feature := range features {
+		totalWeight += feature.weight
+	}
+
+	var maxScore float64
+	var bestID string
+	for _, c := range mostRelevant {
+		c.distance = distances[c.id]
+
+		var score float64
+		for _, feature := range features {
+			if feature.weight > 0 {
+				score += feature.weight * feature.relevance(normalisedEntry, c)
 			}
+		}
 
+		score = score / totalWeight
+		if score > maxScore {
+			bestID = c.id
+			maxScore = score
 		}
 	}
 
-	fmt.Printf("A total of %d out of %d movies were matched with a Wikipedia entry\n", len(results), len(moviesMetadata))
-
-	// Write results
-	fout, err := os.Create("output_matching.csv")
-	if err != nil {
-		return err
+	if !config.accepts(maxScore) {
+		return nil
 	}
-	defer fout.Close()
-	writer := csv.NewWriter(fout)
-	if err := writer.Write([]string{"id", "url", "abstract", "score"}); err != nil {
-		return err
+
+	return &scoredEntry{
+		id: bestID,
+		result: &matchResult{
+			score:    maxScore,
+			url:      entry.url,
+			abstract: entry.abstract,
+		},
 	}
+}
+
+// matchColumns are the columns of the file written by `writeMatches`
+var matchColumns = []outputColumn{{"id", typeString}, {"url", typeString}, {"abstract", typeString}, {"score", typeFloat}}
+
+// writeMatches writes the matches in the given format. CSV files can be read back with `readWikiMatches`.
+func writeMatches(w io.Writer, results matchResults, format string, order sortOrder) error {
+	t := &outputTable{columns: matchColumns, rows: make([][]interface{}, 0, len(results))}
 	for id, res := range results {
-		writer.Write([]string{id, res.url, res.abstract, fmt.Sprintf("%f", res.score)})
+		t.rows = append(t.rows, []interface{}{id, res.url, res.abstract, res.score})
 	}
-	writer.Flush()
 
-	return writer.Error()
+	return writeTable(w, format, t, order)
+}
+
+// candidate is a movie relevant to a Wikipedia entry, along with the edit distance between its title and
+// the title of the entry, which is 0 if the movie was not found by its title
+type candidate struct {
+	id       string
+	distance int
 }
 
 // matching provides the specification for features to match against a wikipedia entry
 type matching interface {
-	// mostRevelant returns a list of most relevant ids in the channel given a wikipedia entry.
-	// WaitGroup.Done() must be called when no further ids are going to be sent.
-	mostRelevant(*wikiEntry) []string
-	// relevance calculates a score between 0 and 1 given a wiki entry and an id
-	relevance(*wikiEntry, string) float64
+	// mostRevelant returns a list of the most relevant movies given a wikipedia entry
+	mostRelevant(*wikiEntry) []candidate
+	// relevance calculates a score between 0 and 1 given a wiki entry and a candidate movie
+	relevance(*wikiEntry, candidate) float64
 }
 
 var _ matching = (*moviesMetadataFeatures)(nil)
 
-func (m *moviesMetadataFeatures) mostRelevant(e *wikiEntry) []string {
+func (m *moviesMetadataFeatures) mostRelevant(e *wikiEntry) []candidate {
 	title := []rune(e.title)
-	return m.trie.walk(title)
-}
+	matches := m.trie.walkFuzzy(title, m.maxDistance)
 
-func walkTrie(out chan<- string) trie.WalkFunc {
-	return func(key string, value interface{}) error {
-		if ids, ok := value.([]string); ok {
-			for _, id := range ids {
-				out <- id
-			}
-		}
-		return nil
+	res := make([]candidate, 0, len(matches))
+	for _, match := range matches {
+		res = append(res, candidate{id: match.value, distance: match.distance})
 	}
+	return res
 }
 
-func (m *moviesMetadataFeatures) relevance(e *wikiEntry, id string) float64 {
-	md, ok := m.data[id]
+func (m *moviesMetadataFeatures) relevance(e *wikiEntry, c candidate) float64 {
+	md, ok := m.data[c.id]
 	if !ok {
 		return 0
 	}
@@ -198,31 +339,46 @@ func (m *moviesMetadataFeatures) relevance(e *wikiEntry, id string) float64 {
 			tokenScore += 1
 		}
 	}
-	tokenScore = tokenScore / float64(len(md.tokens))
+	if len(md.tokens) > 0 {
+		tokenScore = tokenScore / float64(len(md.tokens))
+	}
 
 	var titleScore float64
 	if md.title != "" && strings.Contains(e.title, md.title) {
-		titleScore = float64(len(md.title)) / float64(len(e.title))
+		titleScore = runeRatio(md.title, e.title)
 	}
 
 	if titleScore == 0 && md.originalTitle != "" && strings.Contains(e.title, md.originalTitle) {
-		titleScore = float64(len(md.originalTitle)) / float64(len(e.title))
+		titleScore = runeRatio(md.originalTitle, e.title)
+	}
+
+	// Titles found within some edits of the Wikipedia title are weighted by how many of their runes are unchanged
+	if titleScore == 0 && c.distance > 0 && md.title != "" {
+		similarity := 1 - float64(c.distance)/float64(utf8.RuneCountInString(md.title))
+		if similarity > 0 {
+			titleScore = similarity * math.Min(1, runeRatio(md.title, e.title))
+		}
 	}
 
-	titleBias := 0.5
-	score := ((1 - titleBias) * tokenScore) + (titleBias * titleScore)
+	score := ((1 - m.titleBias) * tokenScore) + (m.titleBias * titleScore)
 
 	return score
 }
 
+// runeRatio returns the number of runes in `s` relative to the number of runes in `of`, so that titles
+// with non-ASCII characters are scored the same as ASCII titles
+func runeRatio(s, of string) float64 {
+	return float64(utf8.RuneCountInString(s)) / float64(utf8.RuneCountInString(of))
+}
+
 var _ matching = moviesCreditsFeatures(nil)
 
-func (m moviesCreditsFeatures) mostRelevant(e *wikiEntry) []string {
+func (m moviesCreditsFeatures) mostRelevant(e *wikiEntry) []candidate {
 	return nil
 }
 
-func (m moviesCreditsFeatures) relevance(e *wikiEntry, id string) float64 {
-	md, ok := m[id]
+func (m moviesCreditsFeatures) relevance(e *wikiEntry, c candidate) float64 {
+	md, ok := m[c.id]
 	if !ok {
 		return 0
 	}
@@ -241,6 +397,82 @@ func (m moviesCreditsFeatures) relevance(e *wikiEntry, id string) float64 {
 	return score / total
 }
 
+var _ matching = (*moviesYearFeatures)(nil)
+
+func (m *moviesYearFeatures) mostRelevant(e *wikiEntry) []candidate {
+	return nil
+}
+
+// relevance scores the release year closest to the release year of the movie, from 1 for the same year
+// down to 0 for years more than `tolerance` years apart. Entries giving no year have no relevance.
+func (m *moviesYearFeatures) relevance(e *wikiEntry, c candidate) float64 {
+	year, ok := m.years[c.id]
+	if !ok {
+		return 0
+	}
+
+	var score float64
+	for _, y := range entryYears(e) {
+		diff := year - y
+		if diff < 0 {
+			diff = -diff
+		}
+		score = math.Max(score, 1-float64(diff)/float64(m.tolerance+1))
+	}
+
+	return score
+}
+
+// abstractYearRegexp finds the release year in the opening sentence of an abstract such as
+// "heat is a 1995 american crime film", or in a mention of its release
+var abstractYearRegexp = regexp.MustCompile(`\b(?:(?:is|was) an?|released in(?: [a-z]+)?(?: [0-9]{1,2})?) ([0-9]{4})\b`)
+
+// entryYears returns the release years given by the title disambiguator and the abstract of a Wikipedia entry
+func entryYears(e *wikiEntry) []int {
+	years := []int{}
+	if e.year != 0 {
+		years = append(years, e.year)
+	}
+
+	for _, match := range abstractYearRegexp.FindAllStringSubmatch(e.abstract, -1) {
+		if year, err := strconv.Atoi(match[1]); err == nil {
+			years = append(years, year)
+		}
+	}
+
+	return years
+}
+
+type matchResults map[string]*matchResult
+
+// add keeps `res` if it has a higher score than the current result for `id`, returning whether it was kept.
+// Ties are broken by the URL of the Wikipedia entry so that the results do not depend on the order
+// entries are added in.
+func (m matchResults) add(id string, res *matchResult) bool {
+	if current, ok := m[id]; ok {
+		if current.score > res.score || (current.score == res.score && current.url <= res.url) {
+			return false
+		}
+	}
+
+	m[id] = res
+	return true
+}
+
+// wikiMatches converts the match results to the representation read from a matching file
+func (m matchResults) wikiMatches() wikiMatches {
+	res := make(wikiMatches, len(m))
+	for id, r := range m {
+		res[id] = &wikiMatch{
+			url:      r.url,
+			abstract: r.abstract,
+			score:    float32(r.score),
+		}
+	}
+
+	return res
+}
+
 type matchResult struct {
 	score    float64
 	url      string
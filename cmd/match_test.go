@@ -2,24 +2,150 @@ package cmd
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
 func Test_matching(t *testing.T) {
 	mdFeatures := &moviesMetadataFeatures{
-		data: map[string]*movieMetadataFeatures{},
-		trie: newTrie(),
+		data:      map[string]*movieMetadataFeatures{},
+		trie:      newTrie(),
+		titleBias: 0.5,
 	}
 	mdFeatures.data["0"] = &movieMetadataFeatures{
-		title: "film title",
+		title:  "film title",
+		tokens: []string{"1999"},
 	}
 	mdFeatures.trie.put([]rune("film title"), "0")
 
-	ids := mdFeatures.mostRelevant(
+	candidates := mdFeatures.mostRelevant(
 		&wikiEntry{
 			title: "film title",
 		},
 	)
-	require.Contains(t, ids, "0")
+	require.Contains(t, candidates, candidate{id: "0"})
+
+	// Titles within the maximum distance are candidates, with a lower relevance than exact titles
+	entry := &wikiEntry{title: "flim title"}
+	require.Empty(t, mdFeatures.mostRelevant(entry))
+	mdFeatures.maxDistance = 2
+	candidates = mdFeatures.mostRelevant(entry)
+	require.Equal(t, []candidate{{id: "0", distance: 2}}, candidates)
+
+	fuzzy := mdFeatures.relevance(entry, candidates[0])
+	exact := mdFeatures.relevance(&wikiEntry{title: "film title"}, candidate{id: "0"})
+	require.Greater(t, fuzzy, 0.0)
+	require.Less(t, fuzzy, exact)
+
+	// Titles with non-ASCII characters have the same relevance as ASCII titles
+	nonASCII := &moviesMetadataFeatures{
+		data:        map[string]*movieMetadataFeatures{"0": {title: "amélie", tokens: []string{"2001"}}},
+		trie:        newTrie(),
+		maxDistance: 2,
+		titleBias:   0.5,
+	}
+	ascii := &moviesMetadataFeatures{
+		data:        map[string]*movieMetadataFeatures{"0": {title: "amelie", tokens: []string{"2001"}}},
+		trie:        newTrie(),
+		maxDistance: 2,
+		titleBias:   0.5,
+	}
+	require.Equal(t,
+		ascii.relevance(&wikiEntry{title: "amelie 2001 film"}, candidate{id: "0"}),
+		nonASCII.relevance(&wikiEntry{title: "amélie 2001 film"}, candidate{id: "0"}))
+	require.Equal(t,
+		ascii.relevance(&wikiEntry{title: "amelia 2001 film"}, candidate{id: "0", distance: 1}),
+		nonASCII.relevance(&wikiEntry{title: "amélia 2001 film"}, candidate{id: "0", distance: 1}))
+
+	// The disambiguator of a Wikipedia title does not reduce the relevance of the movie
+	disambiguated := &wikiEntry{}
+	disambiguated.setTitle("Film Title (1999 film)")
+	scored := scoreEntry(disambiguated, []weightedFeature{{matching: mdFeatures, weight: 1}}, defaultScoringConfig())
+	require.Equal(t, "0", scored.id)
+	require.Equal(t, exact, scored.result.score)
+}
+
+func Test_yearFeatures(t *testing.T) {
+	metadata := moviesMetadata{
+		"0": &movieMetadata{title: "Heat", year: time.Date(1995, 12, 15, 0, 0, 0, 0, time.UTC)},
+		"1": &movieMetadata{title: "Heat"},
+	}
+	features := metadata.yearFeatures(1)
+
+	tests := []struct {
+		name     string
+		entry    *wikiEntry
+		expected float64
+	}{
+		{name: "disambiguator year", entry: &wikiEntry{year: 1995}, expected: 1},
+		{name: "abstract year", entry: &wikiEntry{abstract: "heat is a 1995 american crime film"}, expected: 1},
+		{name: "following year", entry: &wikiEntry{abstract: "heat was a 1996 american crime film"}, expected: 0.5},
+		{name: "release year", entry: &wikiEntry{abstract: "the film was released in january 1996"}, expected: 0.5},
+		{name: "closest year", entry: &wikiEntry{year: 1986, abstract: "heat is a 1995 american crime film"}, expected: 1},
+		{name: "outside tolerance", entry: &wikiEntry{year: 1986}, expected: 0},
+		{name: "year mentioned elsewhere", entry: &wikiEntry{abstract: "heat is an american crime film set in 1995"}, expected: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, features.relevance(test.entry, candidate{id: "0"}))
+			// Movies without a release date are not scored
+			require.Zero(t, features.relevance(test.entry, candidate{id: "1"}))
+		})
+	}
+
+	require.Empty(t, features.mostRelevant(&wikiEntry{year: 1995}))
+
+	// The release year tells apart movies with the same title once the year feature is enabled
+	defer func() { matchScoring = defaultScoringConfig() }()
+	matchScoring.Disabled = []string{}
+	metadata["2"] = &movieMetadata{title: "Heat", year: time.Date(1986, 3, 14, 0, 0, 0, 0, time.UTC)}
+	for _, title := range []string{"Heat (1995 film)", "Heat (1986 film)"} {
+		entry := &wikiEntry{url: title}
+		entry.setTitle(title)
+		movieEntries := make(chan *wikiEntry, 1)
+		movieEntries <- entry
+		close(movieEntries)
+
+		results := matchMovies(movieEntries, metadata, moviesCredits{}, 1)
+		require.Len(t, results, 1)
+		for id := range results {
+			require.Equal(t, entry.year, metadata[id].year.Year())
+		}
+	}
+}
+
+func Test_matchMovies(t *testing.T) {
+	metadata := moviesMetadata{
+		"0": &movieMetadata{title: "Film Foo", originalTitle: "Film Foo", production: []string{"Foo Studios"}},
+		"1": &movieMetadata{title: "Film Bar", originalTitle: "Film Bar", production: []string{"Bar Studios"}},
+		"2": &movieMetadata{title: "Film Baz", originalTitle: "Film Baz", production: []string{"Baz Studios"}},
+	}
+	credits := moviesCredits{
+		"0": &movieCredits{cast: []string{"Bob"}},
+	}
+	entries := []*wikiEntry{
+		{title: "Film Foo", url: "https://en.wikipedia.org/wiki/Film_Foo_2", abstract: "A film"},
+		{title: "Film Foo", url: "https://en.wikipedia.org/wiki/Film_Foo_1", abstract: "A film"},
+		{title: "Film Foo (film)", url: "https://en.wikipedia.org/wiki/Film_Foo_(film)", abstract: "A film starring Bob"},
+		{title: "Film Bar", url: "https://en.wikipedia.org/wiki/Film_Bar_2", abstract: "A film"},
+		{title: "Film Bar", url: "https://en.wikipedia.org/wiki/Film_Bar_1", abstract: "A film"},
+		{title: "Another film", url: "https://en.wikipedia.org/wiki/Another_film", abstract: "A film"},
+	}
+
+	for _, workers := range []int{1, 4} {
+		movieEntries := make(chan *wikiEntry, len(entries))
+		for _, entry := range entries {
+			movieEntries <- entry
+		}
+		close(movieEntries)
+
+		results := matchMovies(movieEntries, metadata, credits, workers)
+		require.Len(t, results, 2)
+		// Matching the cast gives a higher score than an exact title
+		require.Equal(t, "https://en.wikipedia.org/wiki/Film_Foo_(film)", results["0"].url)
+		// Ties are broken by URL
+		require.Equal(t, "https://en.wikipedia.org/wiki/Film_Bar_1", results["1"].url)
+	}
 }
@@ -0,0 +1,365 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage the schema of the database the movies are loaded to",
+	}
+
+	migrateUpCmd = &cobra.Command{
+		Use:   "up <database_uri>",
+		Short: "Apply all pending migrations",
+		RunE:  migrateUp,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	migrateDownCmd = &cobra.Command{
+		Use:   "down <database_uri>",
+		Short: "Revert the most recently applied migrations",
+		RunE:  migrateDown,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	migrateStatusCmd = &cobra.Command{
+		Use:   "status <database_uri>",
+		Short: "List the migrations and whether they have been applied",
+		RunE:  migrateStatus,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	migrateSteps int
+)
+
+func init() {
+	migrateCmd.AddCommand(migrateUpCmd)
+	migrateCmd.AddCommand(migrateDownCmd)
+	migrateCmd.AddCommand(migrateStatusCmd)
+
+	migrateDownCmd.Flags().IntVar(&migrateSteps, "steps", 1, "number of migrations to revert")
+}
+
+// migration is a change to the database schema
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// readMigrations reads the migrations from `fsys`, ordered by version
+func readMigrations(fsys fs.FS) ([]*migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, file := range files {
+		parts := migrationFileRegexp.FindStringSubmatch(file)
+		if parts == nil {
+			return nil, fmt.Errorf("migration file %q is not named <version>_<name>.up.sql or <version>_<name>.down.sql", file)
+		}
+
+		version, _ := strconv.Atoi(parts[1])
+		m, exists := byVersion[version]
+		if !exists {
+			m = &migration{version: version, name: parts[2]}
+			byVersion[version] = m
+		}
+		if m.name != parts[2] {
+			return nil, fmt.Errorf("migration version %d has files with different names %q and %q", version, m.name, parts[2])
+		}
+
+		contents, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		if parts[3] == "up" {
+			m.up = string(contents)
+		} else {
+			m.down = string(contents)
+		}
+	}
+
+	res := make([]*migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		res = append(res, m)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].version < res[j].version })
+
+	for i, m := range res {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("migration version %d is missing", i+1)
+		}
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both an up and a down file", m.version, m.name)
+		}
+	}
+
+	return res, nil
+}
+
+// checkKnownMigrations returns an error if a migration has been applied to the database by a newer version of the tool
+func checkKnownMigrations(applied map[int]time.Time, migrations []*migration) error {
+	known := make(map[int]bool, len(migrations))
+	for _, m := range migrations {
+		known[m.version] = true
+	}
+
+	unknown := []int{}
+	for version := range applied {
+		if !known[version] {
+			unknown = append(unknown, version)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Ints(unknown)
+		return fmt.Errorf("database schema has migration %d applied which is not known to this version of the tool", unknown[0])
+	}
+
+	return nil
+}
+
+// checkSchemaVersion returns an error unless exactly the known migrations have been applied
+func checkSchemaVersion(applied map[int]time.Time, migrations []*migration) error {
+	if err := checkKnownMigrations(applied, migrations); err != nil {
+		return err
+	}
+
+	pending := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.version]; !ok {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("database schema is out of date with %d pending migrations, run the migrate up command to update it", pending)
+	}
+
+	return nil
+}
+
+// checkSchema returns an error if the schema of the database is not up to date
+func checkSchema(s sink) error {
+	migrations, err := s.migrations()
+	if err != nil {
+		return err
+	}
+
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return fmt.Errorf("could not read the database schema version: %v", err)
+	}
+
+	return checkSchemaVersion(applied, migrations)
+}
+
+// migrator applies and reverts migrations, recording them in the `schema_migrations` table
+type migrator struct {
+	db *sql.DB
+	// createTableStmt creates the `schema_migrations` table if it does not exist
+	createTableStmt string
+	// tableExistsStmt returns whether the `schema_migrations` table exists
+	tableExistsStmt string
+	// lockStmt, if set, locks the database until the end of the transaction
+	lockStmt string
+}
+
+// appliedMigrations returns the versions of the migrations applied to the database along with when they were applied
+func (m *migrator) appliedMigrations() (map[int]time.Time, error) {
+	res := make(map[int]time.Time)
+
+	var exists bool
+	if err := m.db.QueryRow(m.tableExistsStmt).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return res, nil
+	}
+
+	rows, err := m.db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		res[version] = appliedAt
+	}
+
+	return res, rows.Err()
+}
+
+// runMigration applies or reverts a migration in a transaction, returning false if it had already been applied or reverted
+func (m *migrator) runMigration(mig *migration, up bool) (bool, error) {
+	var changed bool
+	err := inTransaction(m.db, func(tx *sql.Tx) error {
+		if m.lockStmt != "" {
+			if _, err := tx.Exec(m.lockStmt); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(m.createTableStmt); err != nil {
+			return err
+		}
+
+		var applied bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", mig.version).Scan(&applied); err != nil {
+			return err
+		}
+		if applied == up {
+			return nil
+		}
+
+		if up {
+			if _, err := tx.Exec(mig.up); err != nil {
+				return fmt.Errorf("could not apply migration %d_%s: %v", mig.version, mig.name, err)
+			}
+			if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", mig.version, mig.name); err != nil {
+				return err
+			}
+		} else {
+			if _, err := tx.Exec(mig.down); err != nil {
+				return fmt.Errorf("could not revert migration %d_%s: %v", mig.version, mig.name, err)
+			}
+			if _, err := tx.Exec("DELETE FROM schema_migrations WHERE version = $1", mig.version); err != nil {
+				return err
+			}
+		}
+
+		changed = true
+		return nil
+	})
+
+	return changed && err == nil, err
+}
+
+// openMigrations opens the database along with its migrations and the migrations which have been applied
+func openMigrations(url string) (sink, []*migration, map[int]time.Time, error) {
+	s, err := openSink(url)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	migrations, err := s.migrations()
+	if err != nil {
+		s.Close()
+		return nil, nil, nil, err
+	}
+
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		s.Close()
+		return nil, nil, nil, err
+	}
+
+	return s, migrations, applied, nil
+}
+
+func migrateUp(cmd *cobra.Command, args []string) error {
+	s, migrations, applied, err := openMigrations(args[0])
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	count := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+
+		ran, err := s.runMigration(m, true)
+		if err != nil {
+			return err
+		}
+		if ran {
+			count++
+			fmt.Fprintf(logOutput, "Applied migration %d_%s\n", m.version, m.name)
+		}
+	}
+
+	fmt.Fprintf(logOutput, "Applied %d migrations, the schema is at version %d\n", count, len(migrations))
+	return nil
+}
+
+func migrateDown(cmd *cobra.Command, args []string) error {
+	if migrateSteps < 1 {
+		return fmt.Errorf("steps has value %d when a positive number is expected", migrateSteps)
+	}
+
+	s, migrations, applied, err := openMigrations(args[0])
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	// Migrations are reverted in order so the latest migration must be known
+	if err := checkKnownMigrations(applied, migrations); err != nil {
+		return err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < migrateSteps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.version]; !ok {
+			continue
+		}
+
+		ran, err := s.runMigration(m, false)
+		if err != nil {
+			return err
+		}
+		if ran {
+			count++
+			fmt.Fprintf(logOutput, "Reverted migration %d_%s\n", m.version, m.name)
+		}
+	}
+
+	fmt.Fprintf(logOutput, "Reverted %d migrations\n", count)
+	return nil
+}
+
+func migrateStatus(cmd *cobra.Command, args []string) error {
+	s, migrations, applied, err := openMigrations(args[0])
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, m := range migrations {
+		appliedAt := "pending"
+		if t, ok := applied[m.version]; ok {
+			appliedAt = t.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", m.version, m.name, appliedAt)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return checkKnownMigrations(applied, migrations)
+}
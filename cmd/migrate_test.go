@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"top-movies/migrations"
+)
+
+func Test_readMigrations(t *testing.T) {
+	file := func(contents string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(contents)}
+	}
+
+	tests := []struct {
+		name     string
+		fsys     fstest.MapFS
+		expected []*migration
+		err      string
+	}{
+		{
+			name: "ordered by version",
+			fsys: fstest.MapFS{
+				"0002_add_foo.up.sql":    file("ALTER TABLE t ADD COLUMN foo TEXT;"),
+				"0002_add_foo.down.sql":  file("ALTER TABLE t DROP COLUMN foo;"),
+				"0001_create_t.up.sql":   file("CREATE TABLE t (id INTEGER);"),
+				"0001_create_t.down.sql": file("DROP TABLE t;"),
+				"README.md":              file("not a migration"),
+			},
+			expected: []*migration{
+				{version: 1, name: "create_t", up: "CREATE TABLE t (id INTEGER);", down: "DROP TABLE t;"},
+				{version: 2, name: "add_foo", up: "ALTER TABLE t ADD COLUMN foo TEXT;", down: "ALTER TABLE t DROP COLUMN foo;"},
+			},
+		},
+		{
+			name: "missing down file",
+			fsys: fstest.MapFS{
+				"0001_create_t.up.sql": file("CREATE TABLE t (id INTEGER);"),
+			},
+			err: "migration 1_create_t must have both an up and a down file",
+		},
+		{
+			name: "missing version",
+			fsys: fstest.MapFS{
+				"0002_add_foo.up.sql":   file("ALTER TABLE t ADD COLUMN foo TEXT;"),
+				"0002_add_foo.down.sql": file("ALTER TABLE t DROP COLUMN foo;"),
+			},
+			err: "migration version 1 is missing",
+		},
+		{
+			name: "invalid name",
+			fsys: fstest.MapFS{
+				"create_t.sql": file("CREATE TABLE t (id INTEGER);"),
+			},
+			err: `migration file "create_t.sql" is not named <version>_<name>.up.sql or <version>_<name>.down.sql`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := readMigrations(test.fsys)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, res)
+		})
+	}
+
+	// The embedded migrations are valid and have the same versions for each database
+	postgres, err := readMigrations(migrations.Postgres)
+	require.NoError(t, err)
+	require.NotEmpty(t, postgres)
+	sqlite, err := readMigrations(migrations.SQLite)
+	require.NoError(t, err)
+	require.Len(t, sqlite, len(postgres))
+	for i := range postgres {
+		require.Equal(t, postgres[i].name, sqlite[i].name)
+	}
+}
+
+func Test_checkSchemaVersion(t *testing.T) {
+	known := []*migration{{version: 1, name: "create_t"}, {version: 2, name: "add_foo"}}
+	now := time.Now()
+
+	require.NoError(t, checkSchemaVersion(map[int]time.Time{1: now, 2: now}, known))
+	require.EqualError(t, checkSchemaVersion(map[int]time.Time{1: now}, known),
+		"database schema is out of date with 1 pending migrations, run the migrate up command to update it")
+	require.EqualError(t, checkSchemaVersion(map[int]time.Time{}, known),
+		"database schema is out of date with 2 pending migrations, run the migrate up command to update it")
+	require.EqualError(t, checkSchemaVersion(map[int]time.Time{1: now, 2: now, 3: now}, known),
+		"database schema has migration 3 applied which is not known to this version of the tool")
+}
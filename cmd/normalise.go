@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	normaliseFold        = "fold"
+	normaliseAnd         = "and"
+	normaliseArticles    = "articles"
+	normalisePunctuation = "punctuation"
+	normaliseNumerals    = "numerals"
+	normaliseNone        = "none"
+)
+
+// normaliseSteps are the steps of the normalisation pipeline, in the order they are applied
+var normaliseSteps = []string{normaliseFold, normaliseAnd, normaliseArticles, normalisePunctuation, normaliseNumerals}
+
+// textNormaliser is the normaliser applied to titles, abstracts and the names compared with abstracts when matching
+var textNormaliser = normaliser{steps: normaliseSteps}
+
+// normaliser normalises text so that different spellings of the same title are equal.
+// Text is always lowercased and its whitespace collapsed, and then each step is applied in the order of `normaliseSteps`:
+//
+//   - fold: decomposes characters with NFKD and strips diacritics, so "Amélie" is "amelie"
+//   - and: replaces "&" with "and"
+//   - articles: removes a leading "the", "a" or "an", as well as a trailing ", the", ", a" or ", an"
+//   - punctuation: removes apostrophes and replaces other punctuation and symbols with spaces
+//   - numerals: replaces Roman numerals from ii to xxxix with Arabic numerals, so "Rocky II" is "rocky 2"
+type normaliser struct {
+	steps []string
+}
+
+// newNormaliser returns the normaliser applying `steps`, where "none" applies no steps
+func newNormaliser(steps []string) (normaliser, error) {
+	res := normaliser{}
+	for _, step := range steps {
+		if step == normaliseNone {
+			continue
+		}
+		if !contains(normaliseSteps, step) {
+			return normaliser{}, fmt.Errorf("unknown normalisation step %q, expected one of %s or %s", step, strings.Join(normaliseSteps, ", "), normaliseNone)
+		}
+	}
+
+	// Steps are always applied in the same order whatever order they are given in
+	for _, step := range normaliseSteps {
+		if contains(steps, step) {
+			res.steps = append(res.steps, step)
+		}
+	}
+
+	return res, nil
+}
+
+func (n normaliser) normalise(s string) string {
+	s = collapseSpaces(strings.ToLower(s))
+	for _, step := range n.steps {
+		switch step {
+		case normaliseFold:
+			s = foldString(s)
+		case normaliseAnd:
+			s = collapseSpaces(strings.ReplaceAll(s, "&", " and "))
+		case normaliseArticles:
+			s = stripArticles(s)
+		case normalisePunctuation:
+			s = collapsePunctuation(s)
+		case normaliseNumerals:
+			s = replaceNumerals(s)
+		}
+	}
+
+	return s
+}
+
+// normaliseText normalises `s` with the normaliser configured for matching
+func normaliseText(s string) string {
+	return textNormaliser.normalise(s)
+}
+
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// foldString decomposes `s` and removes the diacritics, recomposing the characters left
+func foldString(s string) string {
+	t := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	res, _, err := transform.String(t, s)
+	if err != nil {
+		return s
+	}
+	return res
+}
+
+var articles = []string{"the", "a", "an"}
+
+// stripArticles removes a leading or trailing article from `s`, where titles sorted by the words after
+// the article are written as "Matrix, The"
+func stripArticles(s string) string {
+	for _, article := range articles {
+		if strings.HasSuffix(s, ", "+article) {
+			return strings.TrimSuffix(s, ", "+article)
+		}
+	}
+	for _, article := range articles {
+		if strings.HasPrefix(s, article+" ") {
+			return strings.TrimPrefix(s, article+" ")
+		}
+	}
+	return s
+}
+
+// collapsePunctuation removes apostrophes so "Schindler's" and "Schindlers" are equal, and replaces other
+// punctuation and symbols such as dashes with a single space
+func collapsePunctuation(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\'' || r == '’' || r == '‘' || r == 'ʼ' || r == '`':
+			return -1
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			return ' '
+		}
+		return r
+	}, s)
+	return collapseSpaces(s)
+}
+
+// romanNumerals maps the Roman numerals ii to xxxix to Arabic numerals. The numeral i is left as it is
+// more often the pronoun, as in "I, Robot".
+var romanNumerals = makeRomanNumerals(2, 39)
+
+func makeRomanNumerals(from, to int) map[string]string {
+	tens := []string{"", "x", "xx", "xxx"}
+	units := []string{"", "i", "ii", "iii", "iv", "v", "vi", "vii", "viii", "ix"}
+
+	res := make(map[string]string, to-from+1)
+	for n := from; n <= to; n++ {
+		res[tens[n/10]+units[n%10]] = fmt.Sprintf("%d", n)
+	}
+	return res
+}
+
+// replaceNumerals replaces the words of `s` which are Roman numerals with Arabic numerals
+func replaceNumerals(s string) string {
+	words := strings.Split(s, " ")
+	for i, word := range words {
+		if numeral, ok := romanNumerals[word]; ok {
+			words[i] = numeral
+		}
+	}
+	return strings.Join(words, " ")
+}
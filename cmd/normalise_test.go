@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_normaliser(t *testing.T) {
+	tests := []struct {
+		name     string
+		steps    []string
+		in       string
+		expected string
+	}{
+		{name: "lowercase and spaces", steps: []string{normaliseNone}, in: "  Amélie  (2001   film) ", expected: "amélie (2001 film)"},
+		{name: "diacritics", steps: []string{normaliseFold}, in: "Amélie", expected: "amelie"},
+		{name: "compatibility characters", steps: []string{normaliseFold}, in: "Ｆinding Nemo ½", expected: "finding nemo 1⁄2"},
+		{name: "and", steps: []string{normaliseAnd}, in: "Fast & Furious", expected: "fast and furious"},
+		{name: "leading article", steps: []string{normaliseArticles}, in: "The Matrix", expected: "matrix"},
+		{name: "trailing article", steps: []string{normaliseArticles}, in: "Matrix, The", expected: "matrix"},
+		{name: "article in a word", steps: []string{normaliseArticles}, in: "Theodore Rex", expected: "theodore rex"},
+		{name: "apostrophes", steps: []string{normalisePunctuation}, in: "Schindler’s List", expected: "schindlers list"},
+		{name: "dashes", steps: []string{normalisePunctuation}, in: "Star Wars: Episode IV – A New Hope", expected: "star wars episode iv a new hope"},
+		{name: "numerals", steps: []string{normaliseNumerals}, in: "Rocky II", expected: "rocky 2"},
+		{name: "numeral one", steps: []string{normaliseNumerals}, in: "I Robot", expected: "i robot"},
+		{name: "numeral in a word", steps: []string{normaliseNumerals}, in: "Vixen", expected: "vixen"},
+		{
+			name:     "all steps",
+			steps:    normaliseSteps,
+			in:       "Star Wars: Episode IV – A New Hope",
+			expected: "star wars episode 4 a new hope",
+		},
+		{
+			name:     "steps in any order",
+			steps:    []string{normaliseNumerals, normalisePunctuation, normaliseArticles},
+			in:       "Godfather Part II, The",
+			expected: "godfather part 2",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n, err := newNormaliser(test.steps)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, n.normalise(test.in))
+		})
+	}
+
+	_, err := newNormaliser([]string{"stem"})
+	require.Error(t, err)
+}
+
+func Test_matchNormalisedTitles(t *testing.T) {
+	defer func() { textNormaliser = normaliser{steps: normaliseSteps} }()
+
+	metadata := moviesMetadata{
+		"0": &movieMetadata{title: "Amelie", originalTitle: "Le Fabuleux Destin d'Amélie Poulain", production: []string{"Claudie Ossard"}},
+		"1": &movieMetadata{title: "Matrix, The", originalTitle: "Matrix, The", production: []string{"Warner Bros."}},
+		"2": &movieMetadata{title: "Rocky II", originalTitle: "Rocky II", production: []string{"United Artists"}},
+		"3": &movieMetadata{title: "Harold & Kumar Go to White Castle", originalTitle: "Harold & Kumar Go to White Castle", production: []string{"New Line Cinema"}},
+	}
+	entries := []*wikiEntry{
+		{title: "Amélie", url: "https://en.wikipedia.org/wiki/Am%C3%A9lie", abstract: "A film"},
+		{title: "The Matrix", url: "https://en.wikipedia.org/wiki/The_Matrix", abstract: "A film"},
+		{title: "Rocky 2", url: "https://en.wikipedia.org/wiki/Rocky_2", abstract: "A film"},
+		{title: "Harold and Kumar Go to White Castle", url: "https://en.wikipedia.org/wiki/Harold_and_Kumar", abstract: "A film"},
+	}
+
+	for _, steps := range [][]string{normaliseSteps, {normaliseNone}} {
+		n, err := newNormaliser(steps)
+		require.NoError(t, err)
+		textNormaliser = n
+
+		movieEntries := make(chan *wikiEntry, len(entries))
+		for _, entry := range entries {
+			movieEntries <- entry
+		}
+		close(movieEntries)
+
+		results := matchMovies(movieEntries, metadata, moviesCredits{}, 1)
+		if len(n.steps) == 0 {
+			// Only lowercasing the titles matches none of the spellings
+			require.Empty(t, results)
+			continue
+		}
+
+		require.Len(t, results, len(entries))
+		for i, entry := range entries {
+			require.Equal(t, entry.url, results[string(rune('0'+i))].url)
+		}
+	}
+}
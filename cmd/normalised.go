@@ -0,0 +1,374 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// normalisedTables are the tables of the normalised schema, in the order they are loaded
+var normalisedTables = []string{"movies", "companies", "people", "movie_companies", "movie_credits"}
+
+var (
+	movieColumns        = []string{"id", "rank", "title", "year", "rating", "budget", "revenue", "ratio", "url", "abstract", "rating_count", "rating_median", "weighted_rating"}
+	companyColumns      = []string{"id", "name"}
+	personColumns       = []string{"id", "name"}
+	movieCompanyColumns = []string{"movie_id", "company_id"}
+	movieCreditColumns  = []string{"movie_id", "person_id", "role", "character", "department", "job", "cast_order"}
+)
+
+const (
+	creditCast = "cast"
+	creditCrew = "crew"
+)
+
+// company is a production company decoded from the `production_companies` column of the movies metadata
+type company struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// credit is a member of the cast or crew decoded from the `cast` or `crew` column of the credits
+type credit struct {
+	PersonID   int    `json:"id"`
+	Name       string `json:"name"`
+	Character  string `json:"character"`
+	Department string `json:"department"`
+	Job        string `json:"job"`
+	Order      *int   `json:"order"`
+	// role is either `creditCast` or `creditCrew`
+	role string
+}
+
+// movieRelations are the production companies and credits of each movie, by movie id
+type movieRelations struct {
+	companies map[string][]*company
+	credits   map[string][]*credit
+}
+
+func newMovieRelations() *movieRelations {
+	return &movieRelations{
+		companies: make(map[string][]*company),
+		credits:   make(map[string][]*credit),
+	}
+}
+
+// readMovieCompanies specifies how to read the production companies from a row of the IMDB `movies_metadata` file
+func readMovieCompanies(res *movieRelations) parseRowFn {
+	return func(row []string, indices map[string]int, stats *outputStats) {
+		var id string
+		var companies []*company
+
+		for columnName, idx := range indices {
+			if idx >= len(row) {
+				stats.addError(errorShortRow, columnName, "", fmt.Errorf("row has %d columns when at least %d is expected", len(row), idx+1))
+				return
+			}
+
+			columnValue := row[idx]
+			switch columnName {
+			case "id":
+				id = columnValue
+			case "production_companies":
+				if err := decodeList(columnValue, &companies); err != nil {
+					stats.addError(errorInvalidList, columnName, columnValue, fmt.Errorf("column has value which cannot be decoded to a list of companies: %v", err))
+					return
+				}
+			}
+		}
+
+		if id != "" {
+			res.companies[id] = companies
+		}
+	}
+}
+
+// readMovieCredits specifies how to read the cast and crew from a row of the IMDB `credits` file
+func readMovieCredits(res *movieRelations) parseRowFn {
+	return func(row []string, indices map[string]int, stats *outputStats) {
+		var id string
+		var credits []*credit
+
+		for columnName, idx := range indices {
+			if idx >= len(row) {
+				stats.addError(errorShortRow, columnName, "", fmt.Errorf("row has %d columns when at least %d is expected", len(row), idx+1))
+				return
+			}
+
+			columnValue := row[idx]
+			switch columnName {
+			case "id":
+				id = columnValue
+			case creditCast, creditCrew:
+				var decoded []*credit
+				if err := decodeList(columnValue, &decoded); err != nil {
+					stats.addError(errorInvalidList, columnName, columnValue, fmt.Errorf("column has value which cannot be decoded to a list of credits: %v", err))
+					return
+				}
+				for _, c := range decoded {
+					c.role = columnName
+				}
+				credits = append(credits, decoded...)
+			}
+		}
+
+		if id != "" {
+			res.credits[id] = credits
+		}
+	}
+}
+
+// withRelations reads a row with `read` and then with `readRelations` if `read` found no errors in the row,
+// so that the relations are read in the same pass over a file and errors are not reported twice
+func withRelations(read parseRowFn, readRelations parseRowFn) parseRowFn {
+	return func(row []string, indices map[string]int, stats *outputStats) {
+		numErrors := len(stats.rowErrors)
+		read(row, indices, stats)
+		if len(stats.rowErrors) == numErrors {
+			readRelations(row, indices, stats)
+		}
+	}
+}
+
+// decodeList decodes a list written as a Python literal, as used by the IMDB dataset, into `v`
+func decodeList(in string, v interface{}) error {
+	if strings.TrimSpace(in) == "" {
+		return nil
+	}
+
+	s, err := pythonToJSON(in)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(s), v)
+}
+
+// pythonToJSON converts a Python literal of lists, dicts, strings, numbers, booleans and `None` to JSON.
+// Unlike `decodeJSON` strings may contain quotes, such as `"Po' Boy"`.
+func pythonToJSON(in string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(in); {
+		c := in[i]
+		switch {
+		case c == '\'' || c == '"':
+			s, n, err := unquotePython(in[i:])
+			if err != nil {
+				return "", fmt.Errorf("invalid string at offset %d: %v", i, err)
+			}
+			quoted, _ := json.Marshal(s)
+			b.Write(quoted)
+			i += n
+		case strings.HasPrefix(in[i:], "None"):
+			b.WriteString("null")
+			i += len("None")
+		case strings.HasPrefix(in[i:], "True"):
+			b.WriteString("true")
+			i += len("True")
+		case strings.HasPrefix(in[i:], "False"):
+			b.WriteString("false")
+			i += len("False")
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	return b.String(), nil
+}
+
+// unquotePython returns the value of the quoted Python string at the start of `in` and its length in bytes
+func unquotePython(in string) (string, int, error) {
+	quote := in[0]
+	var b strings.Builder
+	for i := 1; i < len(in); {
+		c := in[i]
+		switch c {
+		case quote:
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 >= len(in) {
+				return "", 0, fmt.Errorf("unterminated escape sequence")
+			}
+			switch e := in[i+1]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'x', 'u':
+				size := 2
+				if e == 'u' {
+					size = 4
+				}
+				if i+2+size > len(in) {
+					return "", 0, fmt.Errorf("invalid escape sequence %q", in[i:])
+				}
+				r, err := strconv.ParseUint(in[i+2:i+2+size], 16, 32)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid escape sequence %q", in[i:i+2+size])
+				}
+				b.WriteRune(rune(r))
+				i += size
+			default:
+				// Escaped quotes and backslashes
+				b.WriteByte(e)
+			}
+			i += 2
+		default:
+			r, size := utf8.DecodeRuneInString(in[i:])
+			b.WriteRune(r)
+			i += size
+		}
+	}
+
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// normalisedRows are the rows of each table of the normalised schema
+type normalisedRows map[string][][]interface{}
+
+// normalise returns the rows of the normalised tables for the ranked movies, with the first movie given rank 1.
+// Only the relations of the given movies are included.
+func normalise(data []*combinedData, relations *movieRelations) normalisedRows {
+	res := make(normalisedRows)
+	companies := make(map[int]bool)
+	people := make(map[int]bool)
+
+	for i, d := range data {
+		res["movies"] = append(res["movies"], []interface{}{d.id, i + 1, d.title, d.year, d.rating, d.budget, d.revenue, d.ratio, d.url, d.abstract, d.ratingCount, d.ratingMedian, d.weightedRating})
+
+		movieCompanies := make(map[int]bool)
+		for _, c := range relations.companies[d.id] {
+			if !companies[c.ID] {
+				companies[c.ID] = true
+				res["companies"] = append(res["companies"], []interface{}{c.ID, c.Name})
+			}
+			if !movieCompanies[c.ID] {
+				movieCompanies[c.ID] = true
+				res["movie_companies"] = append(res["movie_companies"], []interface{}{d.id, c.ID})
+			}
+		}
+
+		for _, c := range relations.credits[d.id] {
+			if !people[c.PersonID] {
+				people[c.PersonID] = true
+				res["people"] = append(res["people"], []interface{}{c.PersonID, c.Name})
+			}
+
+			var order interface{}
+			if c.Order != nil {
+				order = *c.Order
+			}
+			res["movie_credits"] = append(res["movie_credits"], []interface{}{d.id, c.PersonID, c.role, nullString(c.Character), nullString(c.Department), nullString(c.Job), order})
+		}
+	}
+
+	return res
+}
+
+// nullString returns nil for an empty string so that it is loaded as NULL
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// tableColumns returns the columns of the `topmovies` table or a table of the normalised schema
+func tableColumns(table string) []string {
+	switch table {
+	case "topmovies":
+		return columns
+	case "movies":
+		return movieColumns
+	case "companies":
+		return companyColumns
+	case "people":
+		return personColumns
+	case "movie_companies":
+		return movieCompanyColumns
+	default:
+		return movieCreditColumns
+	}
+}
+
+// loadNormalised loads the ranked movies along with their companies and credits to the tables of the normalised schema.
+// It returns the number of movies inserted, updated and deleted.
+func loadNormalised(tx *sql.Tx, data []*combinedData, relations *movieRelations) (int64, int64, int64, error) {
+	var inserted, updated, deleted int64
+
+	rows := normalise(data, relations)
+	for _, table := range normalisedTables {
+		if _, err := tx.Exec(fmt.Sprintf(createTempTableStmt, table)); err != nil {
+			return 0, 0, 0, err
+		}
+		if err := copyIn(tx, table+"_staging", tableColumns(table), rows[table]); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	switch loadMode {
+	case loadReplace:
+		if _, err := tx.Exec("TRUNCATE " + strings.Join(normalisedTables, ", ")); err != nil {
+			return 0, 0, 0, err
+		}
+		for _, table := range normalisedTables {
+			if _, err := tx.Exec(insertStagingStmt(table, tableColumns(table))); err != nil {
+				return 0, 0, 0, err
+			}
+		}
+		inserted = int64(len(rows["movies"]))
+	case loadUpsert:
+		if err := tx.QueryRow(upsertStmt("movies", movieColumns)).Scan(&inserted, &updated); err != nil {
+			return 0, 0, 0, err
+		}
+		for _, table := range []string{"companies", "people"} {
+			if _, err := tx.Exec(upsertStmt(table, tableColumns(table))); err != nil {
+				return 0, 0, 0, err
+			}
+		}
+		// The companies and credits of the loaded movies are replaced
+		for _, table := range []string{"movie_companies", "movie_credits"} {
+			stmt := fmt.Sprintf("DELETE FROM %[1]s WHERE movie_id IN (SELECT id FROM movies_staging); INSERT INTO %[1]s (%[2]s) SELECT %[2]s FROM %[1]s_staging;", table, strings.Join(tableColumns(table), ", "))
+			if _, err := tx.Exec(stmt); err != nil {
+				return 0, 0, 0, err
+			}
+		}
+		if deleteMissing {
+			// The companies and credits of deleted movies are deleted by the foreign keys
+			res, err := tx.Exec(fmt.Sprintf(deleteMissingStmt, "movies"))
+			if err != nil {
+				return 0, 0, 0, err
+			}
+			if deleted, err = res.RowsAffected(); err != nil {
+				return 0, 0, 0, err
+			}
+		}
+	case loadAppend:
+		// Only the companies and credits of new movies are added
+		for _, table := range []string{"movie_companies", "movie_credits"} {
+			if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s_staging WHERE movie_id IN (SELECT id FROM movies)", table)); err != nil {
+				return 0, 0, 0, err
+			}
+		}
+		res, err := tx.Exec(appendStmt("movies", movieColumns))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if inserted, err = res.RowsAffected(); err != nil {
+			return 0, 0, 0, err
+		}
+		for _, table := range normalisedTables[1:] {
+			if _, err := tx.Exec(appendStmt(table, tableColumns(table))); err != nil {
+				return 0, 0, 0, err
+			}
+		}
+	}
+
+	return inserted, updated, deleted, nil
+}
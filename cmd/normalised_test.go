@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_pythonToJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  string
+		err  bool
+	}{
+		{
+			name: "single quotes",
+			in:   `[{'id': 3, 'name': 'Pixar'}]`,
+			out:  `[{"id": 3, "name": "Pixar"}]`,
+		},
+		{
+			name: "quotes within strings",
+			in:   `[{'name': "Po' Boy", 'job': 'Say \'hi\''}]`,
+			out:  `[{"name": "Po' Boy", "job": "Say 'hi'"}]`,
+		},
+		{
+			name: "None and booleans",
+			in:   `{'profile_path': None, 'adult': False, 'video': True}`,
+			out:  `{"profile_path": null, "adult": false, "video": true}`,
+		},
+		{
+			name: "escapes and unicode",
+			in:   `['caf\xe9', 'Amélie', 'Zoë', 'a "b"']`,
+			out:  `["café", "Amélie", "Zoë", "a \"b\""]`,
+		},
+		{
+			name: "unterminated string",
+			in:   `[{'name': 'Bob}]`,
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := pythonToJSON(test.in)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.out, out)
+		})
+	}
+}
+
+func Test_readMovieRelations(t *testing.T) {
+	relations := newMovieRelations()
+
+	fin := csv.NewReader(strings.NewReader(`id,production_companies
+1,"[{'name': 'Pixar Animation Studios', 'id': 3}]"
+2,[]
+3,not a list`))
+	stats := makeStats("movies_metadata.csv")
+	err := readCSV(fin, stats, csvColumns{required: []string{"id", "production_companies"}}, nil, readMovieCompanies(relations))
+	require.NoError(t, err)
+	require.Equal(t, map[string][]*company{
+		"1": {{ID: 3, Name: "Pixar Animation Studios"}},
+		"2": {},
+	}, relations.companies)
+	require.Equal(t, map[errorCategory]int{errorInvalidList: 1}, stats.categoryCounts())
+
+	fin = csv.NewReader(strings.NewReader(`cast,crew,id
+"[{'cast_id': 14, 'character': 'Woody (voice)', 'id': 31, 'name': 'Tom Hanks', 'order': 0}]","[{'department': 'Directing', 'id': 7879, 'job': 'Director', 'name': 'John Lasseter'}]",1`))
+	err = readCSV(fin, makeStats("credits.csv"), csvColumns{required: []string{"id", "cast", "crew"}}, nil, readMovieCredits(relations))
+	require.NoError(t, err)
+
+	order := 0
+	require.ElementsMatch(t, []*credit{
+		{PersonID: 31, Name: "Tom Hanks", Character: "Woody (voice)", Order: &order, role: creditCast},
+		{PersonID: 7879, Name: "John Lasseter", Department: "Directing", Job: "Director", role: creditCrew},
+	}, relations.credits["1"])
+}
+
+func Test_normalise(t *testing.T) {
+	data := []*combinedData{{id: "1", title: "film foo"}, {id: "2", title: "film bar"}}
+	order := 1
+	relations := &movieRelations{
+		companies: map[string][]*company{
+			"1": {{ID: 3, Name: "Foo Studios"}, {ID: 3, Name: "Foo Studios"}},
+			"2": {{ID: 3, Name: "Foo Studios"}, {ID: 4, Name: "Bar Studios"}},
+			// Relations of movies which are not loaded are left out
+			"5": {{ID: 5, Name: "Baz Studios"}},
+		},
+		credits: map[string][]*credit{
+			"1": {{PersonID: 10, Name: "Bob", Character: "Himself", Order: &order, role: creditCast}},
+			"2": {{PersonID: 10, Name: "Bob", Department: "Directing", Job: "Director", role: creditCrew}},
+		},
+	}
+
+	rows := normalise(data, relations)
+	require.Len(t, rows["movies"], 2)
+	require.Equal(t, 1, rows["movies"][0][1])
+	require.Equal(t, [][]interface{}{{3, "Foo Studios"}, {4, "Bar Studios"}}, rows["companies"])
+	require.Equal(t, [][]interface{}{{"1", 3}, {"2", 3}, {"2", 4}}, rows["movie_companies"])
+	require.Equal(t, [][]interface{}{{10, "Bob"}}, rows["people"])
+	require.Equal(t, [][]interface{}{
+		{"1", 10, creditCast, "Himself", nil, nil, 1},
+		{"2", 10, creditCrew, nil, "Directing", "Director", nil},
+	}, rows["movie_credits"])
+}
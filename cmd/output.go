@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// stdoutPath is the output path used to write to stdout
+const stdoutPath = "-"
+
+var (
+	outDir string
+
+	// logOutput is where progress information is written. It is changed to stderr when
+	// writing the output of a command to stdout.
+	logOutput io.Writer = os.Stdout
+)
+
+// outputPath returns the path an output file is written to.
+// Relative paths are resolved against the output directory if one is given.
+func outputPath(path string) string {
+	if path == stdoutPath || outDir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(outDir, path)
+}
+
+// writeFile writes the output of a command to `path` using `write`, or to stdout if `path` is "-".
+// The output is written to a temporary file which is renamed to `path` once all data has been written,
+// so a command which fails part way through never leaves an incomplete output file.
+func writeFile(path string, write func(io.Writer) error) error {
+	if path == stdoutPath {
+		return write(os.Stdout)
+	}
+
+	path = outputPath(path)
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("could not create output directory %q: %v", dir, err)
+	}
+
+	fout, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("error creating output file: %v", err)
+	}
+	defer os.Remove(fout.Name())
+	defer fout.Close()
+
+	if err := write(fout); err != nil {
+		return err
+	}
+
+	if err := fout.Close(); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+
+	// Temporary files are only readable by the owner
+	if err := os.Chmod(fout.Name(), 0644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(fout.Name(), path); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+
+	return nil
+}
+
+// sortOrder specifies the column rows of an output file are sorted by
+type sortOrder struct {
+	column     string
+	descending bool
+}
+
+// defaultSortOrder sorts rows by movie id
+var defaultSortOrder = sortOrder{column: "id"}
+
+// parseSortOrder parses a sort order given as `column`, `column:asc` or `column:desc`
+func parseSortOrder(s string) (sortOrder, error) {
+	column, direction := s, "asc"
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		column, direction = s[:i], s[i+1:]
+	}
+
+	if column == "" {
+		return sortOrder{}, fmt.Errorf("sort order %q does not specify a column", s)
+	}
+
+	switch direction {
+	case "asc":
+		return sortOrder{column: column}, nil
+	case "desc":
+		return sortOrder{column: column, descending: true}, nil
+	default:
+		return sortOrder{}, fmt.Errorf("sort order %q has direction %q when asc or desc is expected", s, direction)
+	}
+}
+
+// sort sorts the rows of `t` by the values of the sort column as they are written to a CSV file.
+// Ties are broken by the first column so that the order is always the same for the same rows.
+func (o sortOrder) sort(t *outputTable) error {
+	idx, err := o.index(t.header())
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(t.rows, func(i, j int) bool {
+		c := compareValues(formatCSVValue(t.rows[i][idx]), formatCSVValue(t.rows[j][idx]), o.descending)
+		if c == 0 {
+			c = compareValues(formatCSVValue(t.rows[i][0]), formatCSVValue(t.rows[j][0]), false)
+		}
+		return c < 0
+	})
+
+	return nil
+}
+
+// index returns the index of the sort column in `header`
+func (o sortOrder) index(header []string) (int, error) {
+	for i, name := range header {
+		if name == o.column {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("cannot sort by column %q, expected one of %s", o.column, strings.Join(header, ", "))
+}
+
+// outputSortOrder parses the sort order of a command and checks the column is in the `header` of its output
+func outputSortOrder(s string, header []string) (sortOrder, error) {
+	order, err := parseSortOrder(s)
+	if err != nil {
+		return sortOrder{}, err
+	}
+
+	if _, err := order.index(header); err != nil {
+		return sortOrder{}, err
+	}
+
+	return order, nil
+}
+
+// sortIDs sorts movie ids in ascending numerical order
+func sortIDs(ids []string) {
+	sort.Slice(ids, func(i, j int) bool {
+		return compareValues(ids[i], ids[j], false) < 0
+	})
+}
+
+// compareValues compares two values of an output file, returning a negative number if `a` is sorted before `b`,
+// a positive number if `a` is sorted after `b` and 0 if they are equal.
+// Numbers are compared numerically and sorted before text. Missing values are always sorted last.
+func compareValues(a, b string, descending bool) int {
+	kindA, numA := valueKind(a)
+	kindB, numB := valueKind(b)
+	if kindA != kindB && (kindA == kindMissing || kindB == kindMissing) {
+		return kindA - kindB
+	}
+
+	var c int
+	switch {
+	case kindA != kindB:
+		c = kindA - kindB
+	case kindA == kindNumber:
+		switch {
+		case numA < numB:
+			c = -1
+		case numA > numB:
+			c = 1
+		}
+	case kindA == kindText:
+		c = strings.Compare(a, b)
+	}
+
+	if descending {
+		return -c
+	}
+	return c
+}
+
+const (
+	kindNumber = iota
+	kindText
+	kindMissing
+)
+
+func valueKind(s string) (int, float64) {
+	if s == "" {
+		return kindMissing, 0
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return kindText, 0
+	}
+	if math.IsNaN(f) {
+		return kindMissing, 0
+	}
+
+	return kindNumber, f
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_writeFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "output.csv")
+
+	// A failed write does not leave any files behind
+	err := writeFile(path, func(w io.Writer) error {
+		fmt.Fprint(w, "id,ratio\n")
+		return fmt.Errorf("failed")
+	})
+	require.Error(t, err)
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+
+	// A successful write replaces any existing file
+	for _, contents := range []string{"first", "second"} {
+		err = writeFile(path, func(w io.Writer) error {
+			_, err := fmt.Fprint(w, contents)
+			return err
+		})
+		require.NoError(t, err)
+
+		actual, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, contents, string(actual))
+	}
+
+	files, err = ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+}
+
+func Test_outputPath(t *testing.T) {
+	defer func() { outDir = "" }()
+
+	outDir = ""
+	require.Equal(t, "output.csv", outputPath("output.csv"))
+
+	outDir = "results"
+	require.Equal(t, filepath.Join("results", "output.csv"), outputPath("output.csv"))
+	require.Equal(t, "/tmp/output.csv", outputPath("/tmp/output.csv"))
+	require.Equal(t, "-", outputPath("-"))
+}
+
+func Test_sortOrder(t *testing.T) {
+	header := []string{"id", "ratio"}
+	rows := func() [][]string {
+		return [][]string{
+			{"10", "2.5"},
+			{"9", "NaN"},
+			{"100", "0.5"},
+			{"11", "2.5"},
+			{"tt1", "1.0"},
+			{"8", ""},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		in       string
+		expected []string
+		wantErr  bool
+	}{
+		{
+			name:     "default",
+			in:       "id",
+			expected: []string{"8", "9", "10", "11", "100", "tt1"},
+		},
+		{
+			name:     "descending",
+			in:       "id:desc",
+			expected: []string{"tt1", "100", "11", "10", "9", "8"},
+		},
+		{
+			name: "ascending with missing values",
+			in:   "ratio:asc",
+			// Missing values are last and sorted by id
+			expected: []string{"100", "tt1", "10", "11", "8", "9"},
+		},
+		{
+			name:     "descending with missing values",
+			in:       "ratio:desc",
+			expected: []string{"10", "11", "tt1", "100", "8", "9"},
+		},
+		{
+			name:    "unknown column",
+			in:      "budget",
+			wantErr: true,
+		},
+		{
+			name:    "unknown direction",
+			in:      "id:up",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			order, err := outputSortOrder(test.in, header)
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			table := &outputTable{columns: []outputColumn{{"id", typeString}, {"ratio", typeString}}}
+			for _, row := range rows() {
+				table.rows = append(table.rows, []interface{}{row[0], row[1]})
+			}
+			require.NoError(t, order.sort(table))
+			ids := []string{}
+			for _, row := range table.rows {
+				ids = append(ids, row[0].(string))
+			}
+			require.Equal(t, test.expected, ids)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	pipelineCmd = &cobra.Command{
+		Use:     "pipeline <imdb.zip> <wiki.xml.gz> <database_uri>",
+		Example: "pipeline ~/Downloads/archive.zip ~/Downloads/enwiki-latest-abstract.xml.gz postgres://localhost/movies",
+		Short:   "Run the ratio, match, combine and load commands in one process",
+		RunE:    pipeline,
+		Args:    cobra.ExactArgs(3),
+	}
+
+	keepIntermediate bool
+)
+
+func init() {
+	pipelineCmd.Flags().BoolVar(&keepIntermediate, "keep-intermediate", false, "write the intermediate ratio, matching and combine CSV files")
+	addRatingFlags(pipelineCmd)
+	addLoadFlags(pipelineCmd)
+	pipelineCmd.Flags().BoolVar(&allowPartial, "allow-partial", false, "keep the entries matched before an error reading the Wikipedia dataset")
+	pipelineCmd.Flags().IntVar(&matchWorkers, "workers", runtime.NumCPU(), "number of goroutines matching Wikipedia entries")
+	addMatchFlags(pipelineCmd)
+}
+
+func pipeline(cmd *cobra.Command, args []string) error {
+	imdbPath, wikiPath, connectionURI := args[0], args[1], args[2]
+	if err := configureMatching(cmd); err != nil {
+		return err
+	}
+
+	// Start reading the Wikipedia dataset whilst the IMDB dataset is read
+	wikiFile, err := openInput(wikiPath, "")
+	if err != nil {
+		return err
+	}
+	defer wikiFile.Close()
+
+	movieEntries, wikiErr := readWikiAsync(xml.NewDecoder(wikiFile))
+
+	// The companies and credits are read along with the data needed for matching for the normalised schema
+	var relations *movieRelations
+	if loadSchema == schemaNormalised {
+		relations = newMovieRelations()
+	}
+
+	fmt.Fprintln(logOutput, "Calculating ratio")
+	moviesMetadata := make(moviesMetadata)
+	readMetadata := readMoviesMetadata(moviesMetadata)
+	if relations != nil {
+		readMetadata = withRelations(readMetadata, readMovieCompanies(relations))
+	}
+	err = readCSVFile(
+		imdbPath,
+		metadataDataset,
+		csvColumns{
+			required: []string{"id", "title", "budget", "revenue", "release_date"},
+			optional: []string{"production_companies", "original_title"},
+		},
+		readMetadata,
+	)
+	if err != nil {
+		return err
+	}
+
+	moviesRatios, numSkipped := moviesMetadata.ratios()
+	fmt.Fprintf(logOutput, "%d rows had 0 revenue/budget\n", numSkipped)
+
+	fmt.Fprintln(logOutput, "Matching movies")
+	moviesCredits := make(moviesCredits)
+	readCredits := readMoviesCredits(moviesCredits)
+	if relations != nil {
+		readCredits = withRelations(readCredits, readMovieCredits(relations))
+	}
+	err = readCSVFile(
+		imdbPath,
+		creditsDataset,
+		csvColumns{required: []string{"id", "crew", "cast"}},
+		readCredits,
+	)
+	if err != nil {
+		return err
+	}
+
+	results := matchMovies(movieEntries, moviesMetadata, moviesCredits, matchWorkers)
+	if err := checkWikiErr(<-wikiErr, results); err != nil {
+		return err
+	}
+	wikiMatches := results.wikiMatches()
+
+	fmt.Fprintln(logOutput, "Combining data")
+	links := make(movieLinks)
+	err = readCSVFile(
+		imdbPath,
+		linksDataset,
+		csvColumns{required: []string{"movieId", "tmdbId"}},
+		readMovieLinks(links),
+	)
+	if err != nil {
+		return err
+	}
+
+	ratings := make(ratings)
+	err = readRatingsFile(imdbPath, links, ratings)
+	if err != nil {
+		return err
+	}
+
+	prior, err := ratingPriorFromFlags(cmd, ratings)
+	if err != nil {
+		return err
+	}
+
+	combinedData := combineData(moviesMetadata, moviesRatios, wikiMatches, ratings, prior)
+
+	if keepIntermediate {
+		if err := writeFile("output_ratio.csv", func(w io.Writer) error { return writeRatios(w, moviesRatios, formatCSV, defaultSortOrder) }); err != nil {
+			return err
+		}
+		if err := writeFile("output_matching.csv", func(w io.Writer) error { return writeMatches(w, results, formatCSV, defaultSortOrder) }); err != nil {
+			return err
+		}
+		if err := writeFile(scoringFilePath("output_matching.csv"), matchScoring.write); err != nil {
+			return err
+		}
+		if err := writeFile("output_combine.csv", func(w io.Writer) error { return writeCombined(w, combinedData, formatCSV, defaultSortOrder) }); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(logOutput, "Loading to the database")
+	return loadCombined(combinedData, relations, connectionURI)
+}
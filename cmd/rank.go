@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rankFields are the values of a movie which can be used to rank movies, returning false if the value is missing
+var rankFields = map[string]func(*combinedData) (float64, bool){
+	"ratio":           func(d *combinedData) (float64, bool) { return nullableValue(d.ratio) },
+	"rating":          func(d *combinedData) (float64, bool) { return nullableValue(d.rating) },
+	"weighted_rating": func(d *combinedData) (float64, bool) { return nullableValue(d.weightedRating) },
+	"revenue":         func(d *combinedData) (float64, bool) { return float64(d.revenue), true },
+	"budget":          func(d *combinedData) (float64, bool) { return float64(d.budget), true },
+}
+
+func nullableValue(f *float32) (float64, bool) {
+	if f == nil {
+		return 0, false
+	}
+	return float64(*f), true
+}
+
+// rankExpr scores a movie for ranking as the weighted sum of its values
+type rankExpr []rankTerm
+
+type rankTerm struct {
+	weight float64
+	field  string
+}
+
+// parseRankExpr parses a rank expression such as `ratio` or `0.7*ratio + 0.3*rating`
+func parseRankExpr(s string) (rankExpr, error) {
+	var res rankExpr
+	for _, term := range strings.Split(s, "+") {
+		term = strings.TrimSpace(term)
+		weight, field := 1.0, term
+		if i := strings.Index(term, "*"); i >= 0 {
+			w, err := strconv.ParseFloat(strings.TrimSpace(term[:i]), 64)
+			if err != nil || math.IsNaN(w) || math.IsInf(w, 0) {
+				return nil, fmt.Errorf("rank expression %q has term %q with an invalid weight", s, term)
+			}
+			weight, field = w, strings.TrimSpace(term[i+1:])
+		}
+
+		if _, ok := rankFields[field]; !ok {
+			return nil, fmt.Errorf("rank expression %q has unknown value %q, expected one of ratio, rating, weighted_rating, revenue or budget", s, field)
+		}
+
+		res = append(res, rankTerm{weight: weight, field: field})
+	}
+
+	return res, nil
+}
+
+// score returns the score of a movie, or false if any of the values used by the expression are missing
+func (r rankExpr) score(d *combinedData) (float64, bool) {
+	var score float64
+	for _, term := range r {
+		v, ok := rankFields[term.field](d)
+		if !ok {
+			return 0, false
+		}
+		score += term.weight * v
+	}
+	return score, true
+}
+
+// rankOptions specifies which movies are ranked and how
+type rankOptions struct {
+	expr rankExpr
+	// minBudget and minVotes exclude movies with a lower budget and number of ratings
+	minBudget int
+	minVotes  int
+	// limit is the maximum number of movies to keep, or 0 for no limit
+	limit int
+}
+
+// rankMovies returns the movies ordered by their rank, with the highest scoring movie first.
+// Movies with a missing score are ranked last and ties are ordered by id.
+func rankMovies(data []*combinedData, opts rankOptions) []*combinedData {
+	res := make([]*combinedData, 0, len(data))
+	for _, d := range data {
+		if d.budget < opts.minBudget || d.ratingCount < opts.minVotes {
+			continue
+		}
+		res = append(res, d)
+	}
+
+	scores := make(map[*combinedData]float64, len(res))
+	for _, d := range res {
+		if score, ok := opts.expr.score(d); ok {
+			scores[d] = score
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		a, okA := scores[res[i]]
+		b, okB := scores[res[j]]
+		if okA != okB {
+			return okA
+		}
+		if okA && a != b {
+			return a > b
+		}
+		return compareValues(res[i].id, res[j].id, false) < 0
+	})
+
+	if opts.limit > 0 && len(res) > opts.limit {
+		res = res[:opts.limit]
+	}
+
+	return res
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseRankExpr(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		expected rankExpr
+		err      bool
+	}{
+		{
+			name:     "single value",
+			expr:     "revenue",
+			expected: rankExpr{{weight: 1, field: "revenue"}},
+		},
+		{
+			name:     "weighted sum",
+			expr:     "0.7*ratio + 0.3 * rating",
+			expected: rankExpr{{weight: 0.7, field: "ratio"}, {weight: 0.3, field: "rating"}},
+		},
+		{
+			name: "unknown value",
+			expr: "ratio+title",
+			err:  true,
+		},
+		{
+			name: "invalid weight",
+			expr: "x*ratio",
+			err:  true,
+		},
+		{
+			name: "empty term",
+			expr: "ratio+",
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := parseRankExpr(test.expr)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, res)
+		})
+	}
+}
+
+func Test_rankMovies(t *testing.T) {
+	data := []*combinedData{
+		{id: "1", ratio: float32Ptr(2), rating: float32Ptr(4), budget: 100, ratingCount: 10},
+		{id: "2", ratio: float32Ptr(5), rating: float32Ptr(2), budget: 200, ratingCount: 3},
+		{id: "3", rating: float32Ptr(5), budget: 300, ratingCount: 20},
+		{id: "4", ratio: float32Ptr(3), budget: 10, ratingCount: 0},
+		{id: "10", ratio: float32Ptr(2), rating: float32Ptr(1), budget: 100, ratingCount: 5},
+	}
+
+	ids := func(data []*combinedData) []string {
+		res := []string{}
+		for _, d := range data {
+			res = append(res, d.id)
+		}
+		return res
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		opts     rankOptions
+		expected []string
+	}{
+		{
+			name:     "ratio with missing values last and ties by id",
+			expr:     "ratio",
+			expected: []string{"2", "4", "1", "10", "3"},
+		},
+		{
+			name:     "weighted sum",
+			expr:     "0.5*ratio+rating",
+			expected: []string{"1", "2", "10", "3", "4"},
+		},
+		{
+			name:     "limit",
+			expr:     "budget",
+			opts:     rankOptions{limit: 2},
+			expected: []string{"3", "2"},
+		},
+		{
+			name:     "thresholds",
+			expr:     "ratio",
+			opts:     rankOptions{minBudget: 100, minVotes: 5},
+			expected: []string{"1", "10", "3"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expr, err := parseRankExpr(test.expr)
+			require.NoError(t, err)
+			test.opts.expr = expr
+			require.Equal(t, test.expected, ids(rankMovies(data, test.opts)))
+		})
+	}
+}
+
+func float32Ptr(f float32) *float32 {
+	return &f
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	priorMean     float64
+	priorVotes    int
+	ratingsBuffer int
+)
+
+// addRatingFlags adds the flags controlling how ratings are read and how the weighted rating is calculated to a command
+func addRatingFlags(cmd *cobra.Command) {
+	cmd.Flags().Float64Var(&priorMean, "prior-mean", 0, "rating movies are weighted towards by the weighted rating, defaults to the mean of all ratings")
+	cmd.Flags().IntVar(&priorVotes, "prior-votes", 10, "number of votes a movie needs for its own ratings to count as much as the prior mean in the weighted rating")
+	cmd.Flags().IntVar(&ratingsBuffer, "ratings-buffer", 0, "find duplicate ratings by sorting them on disk in runs of this many ratings, bounding the memory used, or 0 to find them in memory")
+}
+
+// ratingPrior is the prior belief about the rating of a movie used by the weighted rating
+type ratingPrior struct {
+	mean  float64
+	votes int
+}
+
+// ratingPriorFromFlags returns the prior given by the flags of `cmd`, using the mean of all ratings
+// unless a prior mean is given
+func ratingPriorFromFlags(cmd *cobra.Command, r ratings) (ratingPrior, error) {
+	if priorVotes < 0 {
+		return ratingPrior{}, fmt.Errorf("--prior-votes has value %d when a number of votes of at least 0 is expected", priorVotes)
+	}
+
+	prior := ratingPrior{mean: r.mean(), votes: priorVotes}
+	if cmd.Flags().Changed("prior-mean") {
+		prior.mean = priorMean
+	}
+
+	return prior, nil
+}
+
+// mean returns the mean of all ratings of all movies, or 0 if there are no ratings
+func (r ratings) mean() float64 {
+	var sum float64
+	var count int
+	for _, val := range r {
+		sum += float64(val.cumulativeRating)
+		count += val.numberOfRatings
+	}
+
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// median returns the median rating for `id`, or nil if there are no ratings
+func (r ratings) median(id string) *float32 {
+	val, exists := r[id]
+	if !exists || val.numberOfRatings == 0 {
+		return nil
+	}
+
+	values := make([]float32, 0, len(val.histogram))
+	for v := range val.histogram {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	// The median is the mean of the middle two ratings for an even number of ratings
+	lower, upper := (val.numberOfRatings-1)/2, val.numberOfRatings/2
+	var lowerValue, upperValue float32
+	seen := 0
+	for _, v := range values {
+		if seen <= lower {
+			lowerValue = v
+		}
+		seen += val.histogram[v]
+		if seen > upper {
+			upperValue = v
+			break
+		}
+	}
+
+	median := (lowerValue + upperValue) / 2
+	return &median
+}
+
+// weighted returns the weighted rating for `id` as used by IMDb, or nil if there are no ratings.
+// The mean rating of the movie is weighted towards the prior mean, so that movies with few votes
+// are not ranked above movies with many votes:
+//
+//	weighted = (v / (v + m)) * R + (m / (v + m)) * C
+//
+// where v is the number of ratings of the movie, R its mean rating, m the prior votes and C the prior mean.
+func (r ratings) weighted(id string, prior ratingPrior) *float32 {
+	val, exists := r[id]
+	if !exists || val.numberOfRatings == 0 {
+		return nil
+	}
+
+	v, m := float64(val.numberOfRatings), float64(prior.votes)
+	mean := float64(val.cumulativeRating) / v
+	weighted := float32((v/(v+m))*mean + (m/(v+m))*prior.mean)
+	return &weighted
+}
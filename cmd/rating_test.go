@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ratings(t *testing.T) {
+	res := make(ratings)
+	parseFn := readMoviesRating(res, nil)
+	indices := map[string]int{"movieId": 0, "userId": 1, "rating": 2}
+	stats := makeStats("ratings.csv")
+
+	rows := [][]string{
+		// A single high rating
+		{"1", "U1", "5"},
+		// Many lower ratings
+		{"2", "U1", "4"},
+		{"2", "U2", "3"},
+		{"2", "U3", "5"},
+		{"2", "U4", "4"},
+		{"2", "U5", "4"},
+		{"2", "U6", "4"},
+		{"3", "U1", "1"},
+		{"3", "U2", "1.5"},
+	}
+	for _, row := range rows {
+		parseFn(row, indices, stats)
+	}
+	require.Empty(t, stats.rowErrors)
+
+	require.InDelta(t, 3.5, res.mean(), 1e-6)
+	require.Zero(t, ratings{}.mean())
+
+	// Medians of odd and even numbers of ratings
+	require.Equal(t, float32Ptr(5), res.median("1"))
+	require.Equal(t, float32Ptr(4), res.median("2"))
+	require.Equal(t, float32Ptr(1.25), res.median("3"))
+	require.Nil(t, res.median("4"))
+
+	prior := ratingPrior{mean: res.mean(), votes: 3}
+	// (1/4)*5 + (3/4)*3.5
+	require.InDelta(t, 3.875, *res.weighted("1", prior), 1e-6)
+	// (6/9)*4 + (3/9)*3.5
+	require.InDelta(t, 3.833333, *res.weighted("2", prior), 1e-6)
+	require.Nil(t, res.weighted("4", prior))
+
+	// Without prior votes the weighted rating is the mean
+	require.Equal(t, res.value("1"), res.weighted("1", ratingPrior{mean: 3.5}))
+
+	// More prior votes rank the movie with many ratings above the single high rating
+	prior.votes = 10
+	require.Greater(t, *res.weighted("2", prior), *res.weighted("1", prior))
+}
@@ -0,0 +1,375 @@
+package cmd
+
+import (
+	"container/heap"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// readRatingsFile reads the IMDB `ratings` file at `path` into `res`, mapping the movie ids with `links` if not nil.
+// Duplicate ratings are found in memory unless `ratingsBuffer` is set, in which case the ratings are
+// sorted on disk by movie and user so that memory use is bounded by the size of the buffer.
+func readRatingsFile(path string, links movieLinks, res ratings) error {
+	columns := csvColumns{required: []string{"movieId", "userId", "rating"}}
+	if ratingsBuffer <= 0 {
+		return readCSVFile(path, ratingsDataset, columns, readMoviesRating(res, links))
+	}
+
+	sorter, err := newRatingsSorter(res, links, ratingsBuffer)
+	if err != nil {
+		return err
+	}
+	defer sorter.Close()
+
+	return readCSVFileWithFinish(path, ratingsDataset, columns, sorter.parseRow, sorter.finish)
+}
+
+// mergeFanIn is the maximum number of runs merged at once, which bounds the number of open files
+var mergeFanIn = 64
+
+// ratingRecord is a rating along with the row it was read from
+type ratingRecord struct {
+	movieID string
+	userID  string
+	rating  float32
+	row     int
+}
+
+// less orders ratings by movie and user, with the first rating of a user for a movie first
+func (r *ratingRecord) less(o *ratingRecord) bool {
+	if r.movieID != o.movieID {
+		return r.movieID < o.movieID
+	}
+	if r.userID != o.userID {
+		return r.userID < o.userID
+	}
+	return r.row < o.row
+}
+
+// ratingsSorter aggregates ratings with an external merge sort. Ratings are buffered in memory and written
+// to a sorted run on disk when the buffer is full. Once all ratings have been read the runs are merged,
+// which orders the ratings of each user for each movie together so duplicates are found without
+// keeping the users who rated each movie.
+type ratingsSorter struct {
+	res        ratings
+	links      movieLinks
+	dir        string
+	bufferSize int
+	buffer     []ratingRecord
+	runs       []string
+	// runCount is the number of runs created, which names the next run
+	runCount int
+	// err is the first error writing a run, which is returned once all rows have been parsed
+	err error
+}
+
+func newRatingsSorter(res ratings, links movieLinks, bufferSize int) (*ratingsSorter, error) {
+	dir, err := ioutil.TempDir("", "top-movies-ratings-")
+	if err != nil {
+		return nil, fmt.Errorf("could not create directory for sorting ratings: %v", err)
+	}
+
+	return &ratingsSorter{
+		res:        res,
+		links:      links,
+		dir:        dir,
+		bufferSize: bufferSize,
+		buffer:     make([]ratingRecord, 0, bufferSize),
+	}, nil
+}
+
+// parseRow is the `parseRowFn` buffering the ratings of the IMDB `ratings` file
+func (s *ratingsSorter) parseRow(row []string, indices map[string]int, stats *outputStats) {
+	if s.err != nil {
+		return
+	}
+
+	id, userID, rating, ok := parseRating(row, indices, s.links, stats)
+	if !ok || id == "" {
+		return
+	}
+
+	s.buffer = append(s.buffer, ratingRecord{movieID: id, userID: userID, rating: rating, row: stats.totalRows})
+	if len(s.buffer) >= s.bufferSize {
+		s.err = s.writeRun()
+	}
+}
+
+func (s *ratingsSorter) sortBuffer() {
+	sort.Slice(s.buffer, func(i, j int) bool { return s.buffer[i].less(&s.buffer[j]) })
+}
+
+// writeRun writes the sorted buffer to a new run and empties the buffer
+func (s *ratingsSorter) writeRun() error {
+	s.sortBuffer()
+	if err := s.createRun(&bufferSource{records: s.buffer}); err != nil {
+		return err
+	}
+
+	s.buffer = s.buffer[:0]
+	return nil
+}
+
+// createRun writes the ratings of `source` to a new run
+func (s *ratingsSorter) createRun(source ratingSource) error {
+	path := filepath.Join(s.dir, fmt.Sprintf("run-%d.csv", s.runCount))
+	s.runCount++
+	fout, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer fout.Close()
+
+	writer := csv.NewWriter(fout)
+	for {
+		r, ok, err := source.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		writer.Write([]string{r.movieID, r.userID, strconv.FormatFloat(float64(r.rating), 'g', -1, 32), strconv.Itoa(r.row)})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	if err := fout.Close(); err != nil {
+		return err
+	}
+
+	s.runs = append(s.runs, path)
+	return nil
+}
+
+// openRuns returns the merge of the runs at `paths`, along with a function closing the runs which are still open
+func openRuns(paths []string) (*ratingSources, func(), error) {
+	sources := &ratingSources{}
+	runs := make([]*runSource, 0, len(paths))
+	closeRuns := func() {
+		for _, run := range runs {
+			run.close()
+		}
+	}
+
+	for _, path := range paths {
+		fin, err := os.Open(path)
+		if err != nil {
+			closeRuns()
+			return nil, nil, err
+		}
+		run := &runSource{file: fin, reader: csv.NewReader(fin)}
+		runs = append(runs, run)
+
+		if err := sources.push(run); err != nil {
+			closeRuns()
+			return nil, nil, err
+		}
+	}
+
+	return sources, closeRuns, nil
+}
+
+// mergeRuns merges the runs into fewer, longer runs until there are at most `mergeFanIn` runs left,
+// so that the final merge does not open more than `mergeFanIn` files at once
+func (s *ratingsSorter) mergeRuns() error {
+	for len(s.runs) > mergeFanIn {
+		paths := s.runs[:mergeFanIn]
+		sources, closeRuns, err := openRuns(paths)
+		if err != nil {
+			return err
+		}
+
+		s.runs = append([]string{}, s.runs[mergeFanIn:]...)
+		err = s.createRun(sources)
+		closeRuns()
+		if err != nil {
+			return err
+		}
+
+		for _, path := range paths {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// finish is the `finishFn` merging the runs, adding the ratings to the results and recording duplicates in `stats`
+func (s *ratingsSorter) finish(stats *outputStats) error {
+	if s.err != nil {
+		return fmt.Errorf("could not sort ratings: %v", s.err)
+	}
+
+	if err := s.mergeRuns(); err != nil {
+		return fmt.Errorf("could not sort ratings: %v", err)
+	}
+	sources, closeRuns, err := openRuns(s.runs)
+	if err != nil {
+		return fmt.Errorf("could not sort ratings: %v", err)
+	}
+	defer closeRuns()
+
+	// The ratings left in the buffer are merged from memory
+	s.sortBuffer()
+	if len(s.buffer) > 0 {
+		sources.push(&bufferSource{records: s.buffer})
+	}
+
+	var duplicates []*parseError
+	var prev ratingRecord
+	for {
+		r, ok, err := sources.next()
+		if err != nil {
+			return fmt.Errorf("could not sort ratings: %v", err)
+		}
+		if !ok {
+			break
+		}
+
+		if r.movieID == prev.movieID && r.userID == prev.userID {
+			duplicates = append(duplicates, &parseError{
+				row:      r.row,
+				category: errorDuplicate,
+				column:   "userId",
+				value:    r.userID,
+				err:      fmt.Errorf("userID %q already seen for id %q", r.userID, r.movieID),
+			})
+			continue
+		}
+
+		s.res.add(r.movieID, r.rating)
+		prev = r
+	}
+
+	// Duplicates are found out of order so the errors are sorted back into the order of their rows
+	stats.rowErrors = append(stats.rowErrors, duplicates...)
+	sort.SliceStable(stats.rowErrors, func(i, j int) bool { return stats.rowErrors[i].row < stats.rowErrors[j].row })
+
+	return nil
+}
+
+// Close removes the runs written to disk
+func (s *ratingsSorter) Close() error {
+	return os.RemoveAll(s.dir)
+}
+
+// ratingSource is a sorted sequence of ratings
+type ratingSource interface {
+	// next returns the next rating, or false once all ratings have been returned
+	next() (ratingRecord, bool, error)
+}
+
+// bufferSource returns the ratings of a sorted buffer
+type bufferSource struct {
+	records []ratingRecord
+}
+
+func (b *bufferSource) next() (ratingRecord, bool, error) {
+	if len(b.records) == 0 {
+		return ratingRecord{}, false, nil
+	}
+
+	r := b.records[0]
+	b.records = b.records[1:]
+	return r, true, nil
+}
+
+// runSource reads the ratings of a run written by `createRun`. The run is closed once all ratings have been read.
+type runSource struct {
+	file   *os.File
+	reader *csv.Reader
+}
+
+func (s *runSource) next() (ratingRecord, bool, error) {
+	record, err := s.reader.Read()
+	if err == io.EOF {
+		s.close()
+		return ratingRecord{}, false, nil
+	}
+	if err != nil {
+		return ratingRecord{}, false, err
+	}
+
+	rating, err := getFloat(record[2])
+	if err != nil {
+		return ratingRecord{}, false, err
+	}
+	row, err := strconv.Atoi(record[3])
+	if err != nil {
+		return ratingRecord{}, false, err
+	}
+
+	return ratingRecord{movieID: record[0], userID: record[1], rating: rating, row: row}, true, nil
+}
+
+func (s *runSource) close() {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+}
+
+// ratingSources is a heap of sources ordered by their current rating, which merges the sources in order
+type ratingSources []*sourceHead
+
+var _ ratingSource = (*ratingSources)(nil)
+
+// sourceHead is a source along with the next rating it returns
+type sourceHead struct {
+	current ratingRecord
+	source  ratingSource
+}
+
+func (h ratingSources) Len() int            { return len(h) }
+func (h ratingSources) Less(i, j int) bool  { return h[i].current.less(&h[j].current) }
+func (h ratingSources) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *ratingSources) Push(x interface{}) { *h = append(*h, x.(*sourceHead)) }
+func (h *ratingSources) Pop() interface{} {
+	old := *h
+	head := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return head
+}
+
+// push adds a source to the heap unless it has no ratings
+func (h *ratingSources) push(source ratingSource) error {
+	r, ok, err := source.next()
+	if err != nil || !ok {
+		return err
+	}
+
+	heap.Push(h, &sourceHead{current: r, source: source})
+	return nil
+}
+
+// next returns the lowest rating of all sources
+func (h *ratingSources) next() (ratingRecord, bool, error) {
+	if h.Len() == 0 {
+		return ratingRecord{}, false, nil
+	}
+	head := (*h)[0]
+	r := head.current
+
+	current, ok, err := head.source.next()
+	if err != nil {
+		return ratingRecord{}, false, err
+	}
+	if ok {
+		head.current = current
+		heap.Fix(h, 0)
+	} else {
+		heap.Pop(h)
+	}
+
+	return r, true, nil
+}
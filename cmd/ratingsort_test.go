@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ratingsSorter(t *testing.T) {
+	defer func() { parsedInputs = nil }()
+
+	in := `userId,movieId,rating,timestamp
+U1,1,4,0
+U2,1,3,0
+U1,2,5,0
+U3,1,4.5,0
+U1,1,1,0
+,2,3,0
+U2,2,2.5,0
+U2,1,5,0
+U3,10,2,0
+U1,2,5,0
+U3,2,bad,0
+`
+	columns := csvColumns{required: []string{"movieId", "userId", "rating"}}
+
+	// Ratings read in memory
+	expected := make(ratings)
+	require.NoError(t, readCSVInput(strings.NewReader(in), "ratings.csv", columns, nil, readMoviesRating(expected, nil), nil))
+	expectedStats := parsedInputs[0]
+
+	for _, bufferSize := range []int{1, 2, 3, 100} {
+		res := make(ratings)
+		sorter, err := newRatingsSorter(res, nil, bufferSize)
+		require.NoError(t, err)
+		require.NoError(t, readCSVInput(strings.NewReader(in), "ratings.csv", columns, nil, sorter.parseRow, sorter.finish))
+		stats := parsedInputs[len(parsedInputs)-1]
+
+		// The same ratings and errors are found in the same order
+		require.Len(t, res, len(expected))
+		for id, val := range expected {
+			require.Equal(t, val.cumulativeRating, res[id].cumulativeRating, "movie %s with buffer size %d", id, bufferSize)
+			require.Equal(t, val.numberOfRatings, res[id].numberOfRatings)
+			require.Equal(t, val.histogram, res[id].histogram)
+		}
+		require.Equal(t, expectedStats.rowErrors, stats.rowErrors)
+		require.Equal(t, 3, stats.categoryCounts()[errorDuplicate])
+
+		// Runs are removed once closed
+		dir := sorter.dir
+		require.NoError(t, sorter.Close())
+		_, err = os.Stat(dir)
+		require.True(t, os.IsNotExist(err))
+	}
+}
+
+func Test_ratingsSorterFanIn(t *testing.T) {
+	defer func() { mergeFanIn, parsedInputs = 64, nil }()
+
+	in := "userId,movieId,rating\n"
+	for i := 0; i < 20; i++ {
+		in += fmt.Sprintf("U%d,%d,%d\n", i%4, i%3, i%5+1)
+	}
+	columns := csvColumns{required: []string{"movieId", "userId", "rating"}}
+
+	expected := make(ratings)
+	require.NoError(t, readCSVInput(strings.NewReader(in), "ratings.csv", columns, nil, readMoviesRating(expected, nil), nil))
+	expectedStats := parsedInputs[0]
+
+	// With a buffer of 1 each rating is written to its own run, which is more runs than can be merged at once
+	for _, fanIn := range []int{2, 3} {
+		mergeFanIn = fanIn
+		res := make(ratings)
+		sorter, err := newRatingsSorter(res, nil, 1)
+		require.NoError(t, err)
+		require.NoError(t, readCSVInput(strings.NewReader(in), "ratings.csv", columns, nil, sorter.parseRow, sorter.finish))
+		stats := parsedInputs[len(parsedInputs)-1]
+
+		require.LessOrEqual(t, len(sorter.runs), fanIn)
+		runs, err := ioutil.ReadDir(sorter.dir)
+		require.NoError(t, err)
+		require.Len(t, runs, len(sorter.runs), "merged runs are removed")
+
+		require.Len(t, res, len(expected))
+		for id, val := range expected {
+			require.Equal(t, val.cumulativeRating, res[id].cumulativeRating, "movie %s with fan-in %d", id, fanIn)
+			require.Equal(t, val.numberOfRatings, res[id].numberOfRatings)
+			require.Equal(t, val.histogram, res[id].histogram)
+		}
+		require.Equal(t, expectedStats.rowErrors, stats.rowErrors)
+		require.NotEmpty(t, stats.rowErrors)
+		require.NoError(t, sorter.Close())
+	}
+}
+
+func Test_readRatingsFile(t *testing.T) {
+	defer func() { ratingsBuffer, parsedInputs = 0, nil }()
+
+	path := filepath.Join(t.TempDir(), "ratings.csv")
+	require.NoError(t, ioutil.WriteFile(path, []byte("userId,movieId,rating\nU1,1,4\nU2,1,3\nU1,1,5\n"), 0644))
+
+	for _, buffer := range []int{0, 1} {
+		ratingsBuffer = buffer
+		res := make(ratings)
+		require.NoError(t, readRatingsFile(path, nil, res))
+		require.Equal(t, float32Ptr(3.5), res.value("1"))
+		require.Equal(t, 2, res.count("1"))
+	}
+}
+
+func Test_readMovieLinks(t *testing.T) {
+	defer func() { ratingsBuffer, parsedInputs = 0, nil }()
+
+	in := `movieId,imdbId,tmdbId
+1,0114709,862
+2,0113497,08844
+3,0113228,
+4,0114885,bad
+`
+	links := make(movieLinks)
+	require.NoError(t, readCSVInput(strings.NewReader(in), "links.csv", csvColumns{required: []string{"movieId", "tmdbId"}}, nil, readMovieLinks(links), nil))
+	require.Equal(t, movieLinks{"1": "862", "2": "8844"}, links)
+	require.Len(t, parsedInputs[0].rowErrors, 1)
+	require.Equal(t, errorInvalidNumber, parsedInputs[0].rowErrors[0].category)
+
+	// Ratings are aggregated by TMDB id and ratings of movies without a TMDB id are reported
+	path := filepath.Join(t.TempDir(), "ratings.csv")
+	require.NoError(t, ioutil.WriteFile(path, []byte("userId,movieId,rating\nU1,1,4\nU1,2,3\nU1,3,5\nU2,5,1\nU2,1,2\n"), 0644))
+	for _, buffer := range []int{0, 1} {
+		ratingsBuffer = buffer
+		res := make(ratings)
+		require.NoError(t, readRatingsFile(path, links, res))
+		require.Equal(t, []string{"862", "8844"}, ratingIDs(res))
+		require.Equal(t, float32Ptr(3), res.value("862"))
+
+		stats := parsedInputs[len(parsedInputs)-1]
+		require.Equal(t, 2, stats.categoryCounts()[errorUnmappedID])
+	}
+}
+
+func ratingIDs(r ratings) []string {
+	ids := make([]string, 0, len(r))
+	for id := range r {
+		ids = append(ids, id)
+	}
+	sortIDs(ids)
+	return ids
+}
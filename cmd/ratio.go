@@ -1,10 +1,8 @@
 package cmd
 
 import (
-	"bufio"
-	"encoding/csv"
 	"fmt"
-	"os"
+	"io"
 
 	"github.com/spf13/cobra"
 )
@@ -17,55 +15,74 @@ var (
 		RunE:    ratio,
 		Args:    cobra.MinimumNArgs(1),
 	}
+
+	ratioOutput string
+	ratioSortBy string
+	ratioFormat string
 )
 
+func init() {
+	ratioCmd.Flags().StringVarP(&ratioOutput, "output", "o", "output_ratio.csv", "output file, or - for stdout")
+	ratioCmd.Flags().StringVar(&ratioSortBy, "sort-by", "id", "output column to sort by, followed by :asc or :desc for the direction")
+	ratioCmd.Flags().StringVar(&ratioFormat, "format", formatCSV, "output format, one of csv, jsonl or parquet")
+}
+
 func ratio(cmd *cobra.Command, args []string) error {
-	movies := args[0]
-	file, err := os.Open(movies)
+	order, err := outputSortOrder(ratioSortBy, columnNames(ratioColumns))
 	if err != nil {
-		return fmt.Errorf("could not open file at %q: %v", movies, err)
+		return err
 	}
-	defer file.Close()
-	fin := csv.NewReader(bufio.NewReader(file))
-
-	moviesMetadataStats := makeStats(movies)
-	moviesMetadata := make(map[string]*movieMetadata)
-	err = readCSV(
-		fin,
-		moviesMetadataStats,
-		[]string{"id", "revenue", "budget"},
+	if err := checkOutputFormat(ratioFormat); err != nil {
+		return err
+	}
+	if !cmd.Flags().Changed("output") {
+		ratioOutput = formatOutputPath(ratioOutput, ratioFormat)
+	}
+
+	moviesMetadata := make(moviesMetadata)
+	err = readCSVFile(
+		args[0],
+		metadataDataset,
+		csvColumns{required: []string{"id", "revenue", "budget"}},
 		readMoviesMetadata(moviesMetadata),
 	)
 	if err != nil {
 		return err
 	}
 
-	output := "output_ratio.csv"
-	fileOut, err := os.Create(output)
-	if err != nil {
-		return fmt.Errorf("error creating output file: %v", err)
-	}
-	defer fileOut.Close()
-	fout := csv.NewWriter(fileOut)
+	moviesRatios, numSkipped := moviesMetadata.ratios()
+	fmt.Fprintf(logOutput, "%d rows had 0 revenue/budget\n", numSkipped)
+
+	return writeFile(ratioOutput, func(w io.Writer) error { return writeRatios(w, moviesRatios, ratioFormat, order) })
+}
 
-	// Write column names of output file
-	fout.Write([]string{"id", "ratio"})
+// ratios calculates the revenue to budget ratio of each movie.
+// Movies without a positive revenue and budget are skipped and counted in the second return value.
+func (m moviesMetadata) ratios() (moviesRatios, int) {
+	res := make(moviesRatios)
 
 	var numSkipped int
-	for id, metadata := range moviesMetadata {
+	for id, metadata := range m {
 		if metadata.revenue <= 0 || metadata.budget <= 0 {
 			numSkipped++
 			continue
 		}
 
-		ratio := float64(metadata.revenue) / float64(metadata.budget)
-		fout.Write([]string{id, fmt.Sprintf("%f", ratio)})
+		res[id] = float64(metadata.revenue) / float64(metadata.budget)
 	}
 
-	fout.Flush()
+	return res, numSkipped
+}
+
+// ratioColumns are the columns of the file written by `writeRatios`
+var ratioColumns = []outputColumn{{"id", typeString}, {"ratio", typeFloat}}
 
-	fmt.Printf("%d rows had 0 revenue/budget\n", numSkipped)
-	fmt.Print(moviesMetadataStats)
+// writeRatios writes the ratios in the given format. CSV files can be read back with `readMoviesRatio`.
+func writeRatios(w io.Writer, ratios moviesRatios, format string, order sortOrder) error {
+	t := &outputTable{columns: ratioColumns, rows: make([][]interface{}, 0, len(ratios))}
+	for id := range ratios {
+		t.rows = append(t.rows, []interface{}{id, ratios[id]})
+	}
 
-	return fout.Error()
+	return writeTable(w, format, t, order)
 }
@@ -1,14 +1,20 @@
 package cmd
 
 import (
+	"bufio"
 	"encoding/csv"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
 // parseRowFn specifies how a row of data should be parsed for a given CSV file.
@@ -17,10 +23,26 @@ import (
 // `stats` tracks a list of errors encountered
 type parseRowFn func(row []string, indices map[string]int, stats *outputStats)
 
+// csvColumns specifies the logical columns read from a CSV file
+type csvColumns struct {
+	// required columns must be present in the header of the file
+	required []string
+	// optional columns are only read if present in the header of the file
+	optional []string
+}
+
+func (c csvColumns) all() []string {
+	return append(append([]string{}, c.required...), c.optional...)
+}
+
 // readCSV reads a CSV file. It expects the first row to contain a list of column names.
-// `columnNames` provides the list of columns used by `parseRow`
-func readCSV(fin *csv.Reader, stats *outputStats, columnNames []string, parseRow parseRowFn) error {
-	fmt.Printf("Reading columns %v from file %s\n", columnNames, stats.inputFile)
+// `columns` provides the list of logical columns used by `parseRow`
+// `mapping` provides the name of each logical column in the header of the file
+// A `*missingColumnsError` is returned if any of the required columns are missing from the header,
+// unless running in lenient mode.
+func readCSV(fin *csv.Reader, stats *outputStats, columns csvColumns, mapping columnMapping, parseRow parseRowFn) error {
+	columnNames := columns.all()
+	fmt.Fprintf(logOutput, "Reading columns %v from file %s\n", columnNames, stats.inputFile)
 
 	row, done, err := readRow(fin, stats)
 	if err != nil {
@@ -34,12 +56,19 @@ func readCSV(fin *csv.Reader, stats *outputStats, columnNames []string, parseRow
 	indices := make(map[string]int, len(columnNames))
 	for i, name := range row {
 		for _, columnName := range columnNames {
-			if name == columnName {
-				indices[name] = i
+			if name == mapping.column(columnName) {
+				indices[columnName] = i
 			}
 		}
 	}
 
+	if err := checkRequiredColumns(columns.required, mapping, indices, row, stats.inputFile); err != nil {
+		if !lenientColumns {
+			return err
+		}
+		fmt.Fprintf(logOutput, "Ignoring error in lenient mode: %v\n", err)
+	}
+
 	for {
 		row, done, err = readRow(fin, stats)
 		if err != nil {
@@ -49,13 +78,63 @@ func readCSV(fin *csv.Reader, stats *outputStats, columnNames []string, parseRow
 			break
 		}
 
-		parseRow(row, indices, stats)
+		// Rows which could not be read have already been recorded as errors by `readRow`
+		if len(row) > 0 {
+			parseRow(row, indices, stats)
+		}
 		stats.totalRows += 1
 	}
 
 	return nil
 }
 
+// readCSVFile opens the CSV file at `path` and reads it using `readCSV`.
+// Compressed files are decompressed as they are read. If `d` is not nil then its column mapping
+// is used and the file is read from the zipped IMDB dataset when given one.
+func readCSVFile(path string, d *dataset, columns csvColumns, parseRow parseRowFn) error {
+	return readCSVFileWithFinish(path, d, columns, parseRow, nil)
+}
+
+// readCSVFileWithFinish reads the CSV file at `path` like `readCSVFile`, calling `finish` once all rows have been parsed
+func readCSVFileWithFinish(path string, d *dataset, columns csvColumns, parseRow parseRowFn, finish finishFn) error {
+	var member string
+	var mapping columnMapping
+	if d != nil {
+		member = d.file
+		mapping = d.mapping
+	}
+
+	file, err := openInput(path, member)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return readCSVInput(file, file.name, columns, mapping, parseRow, finish)
+}
+
+// finishFn is called once every row of an input has been parsed, for parsing which can only find
+// some errors once all rows have been seen. Errors are added to `stats` in the order of their rows.
+type finishFn func(stats *outputStats) error
+
+// readCSVInput reads CSV data from `in` using `readCSV`, calls `finish` if given and prints the parsing stats.
+// `name` identifies the input in the parsing stats.
+func readCSVInput(in io.Reader, name string, columns csvColumns, mapping columnMapping, parseRow parseRowFn, finish finishFn) error {
+	stats := makeStats(name)
+	if err := readCSV(csv.NewReader(bufio.NewReader(in)), stats, columns, mapping, parseRow); err != nil {
+		return err
+	}
+	if finish != nil {
+		if err := finish(stats); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprint(logOutput, stats)
+	parsedInputs = append(parsedInputs, stats)
+	return nil
+}
+
 func readRow(fin *csv.Reader, stats *outputStats) ([]string, bool, error) {
 	row, err := fin.Read()
 	if err != nil {
@@ -64,7 +143,7 @@ func readRow(fin *csv.Reader, stats *outputStats) ([]string, bool, error) {
 		}
 
 		if parseError, ok := err.(*csv.ParseError); ok {
-			stats.rowErrors[stats.totalRows] = fmt.Errorf("could not parse line at %d and column %d: %v", parseError.StartLine-1, parseError.Column, parseError.Err)
+			stats.addError(errorCSVSyntax, "", "", fmt.Errorf("could not parse line at %d and column %d: %v", parseError.StartLine-1, parseError.Column, parseError.Err))
 			return []string{}, false, nil
 		} else {
 			return nil, false, fmt.Errorf("could not read record: %v", err)
@@ -82,7 +161,7 @@ func readMoviesMetadata(res moviesMetadata) parseRowFn {
 
 		for columnName, idx := range indices {
 			if idx >= len(row) {
-				stats.rowErrors[stats.totalRows] = fmt.Errorf("row has %d columns when at least %d is expected", len(row), idx+1)
+				stats.addError(errorShortRow, columnName, "", fmt.Errorf("row has %d columns when at least %d is expected", len(row), idx+1))
 				return
 			}
 
@@ -99,21 +178,21 @@ func readMoviesMetadata(res moviesMetadata) parseRowFn {
 			case "revenue":
 				revenue, err := getInt(columnValue)
 				if err != nil {
-					stats.rowErrors[stats.totalRows] = fmt.Errorf("column has value %q which cannot be converted to an int for revenue", columnValue)
+					stats.addError(errorInvalidNumber, columnName, columnValue, fmt.Errorf("column has value %q which cannot be converted to an int for revenue", columnValue))
 					return
 				}
 				val.revenue = revenue
 			case "budget":
 				budget, err := getInt(columnValue)
 				if err != nil {
-					stats.rowErrors[stats.totalRows] = fmt.Errorf("column has value %q which cannot be converted to an int for budget", columnValue)
+					stats.addError(errorInvalidNumber, columnName, columnValue, fmt.Errorf("column has value %q which cannot be converted to an int for budget", columnValue))
 					return
 				}
 				val.budget = budget
 			case "release_date":
 				year, err := getTime(columnValue)
 				if err != nil {
-					stats.rowErrors[stats.totalRows] = fmt.Errorf("column has value %q which cannot be converted to a date for year", columnValue)
+					stats.addError(errorInvalidDate, columnName, columnValue, fmt.Errorf("column has value %q which cannot be converted to a date for year", columnValue))
 					return
 				}
 				val.year = year
@@ -136,30 +215,84 @@ func getFloat(s string) (float32, error) {
 	return float32(f), err
 }
 
+// getNullableFloat parses an optional float, returning nil for an empty value.
+// `NaN` is also read as a missing value, as it was written for missing values by previous versions.
+func getNullableFloat(s string) (*float32, error) {
+	if s == "" || strings.EqualFold(s, "NaN") {
+		return nil, nil
+	}
+
+	f, err := getFloat(s)
+	if err != nil || math.IsNaN(float64(f)) {
+		return nil, err
+	}
+	return &f, nil
+}
+
 func getTime(s string) (time.Time, error) {
 	return time.Parse("2006-01-02", s)
 }
 
 type moviesMetadata map[string]*movieMetadata
 
-func (m moviesMetadata) features() *moviesMetadataFeatures {
+// features returns the features used for matching, finding movies by titles within `maxDistance` edits
+// and weighting the title score by `titleBias`. The release year is one of the tokens of each movie
+// when `yearTokens` is set, which is when the year feature is disabled.
+func (m moviesMetadata) features(maxDistance int, titleBias float64, yearTokens bool) *moviesMetadataFeatures {
 	features := &moviesMetadataFeatures{
-		data: map[string]*movieMetadataFeatures{},
-		trie: newTrie(),
+		data:        map[string]*movieMetadataFeatures{},
+		trie:        newTrie(),
+		maxDistance: maxDistance,
+		titleBias:   titleBias,
 	}
 
-	for id, metadata := range m {
-		features.data[id] = metadata.feature()
+	// Add ids in order so that ids with the same title are always returned in the same order by the trie
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sortIDs(ids)
 
-		features.trie.put([]rune(normaliseString(metadata.title)), id)
+	for _, id := range ids {
+		metadata := m[id]
+		if yearTokens {
+			features.data[id] = metadata.feature()
+		} else {
+			features.data[id] = metadata.companiesFeature()
+		}
+
+		features.trie.put([]rune(normaliseText(metadata.title)), id)
 		if metadata.originalTitle != metadata.title {
-			features.trie.put([]rune(normaliseString(metadata.originalTitle)), id)
+			features.trie.put([]rune(normaliseText(metadata.originalTitle)), id)
+		}
+	}
+
+	return features
+}
+
+// yearFeatures returns the feature scoring the release years of movies, allowing years within `tolerance`
+// years of each other. Movies without a release date are not scored.
+func (m moviesMetadata) yearFeatures(tolerance int) *moviesYearFeatures {
+	features := &moviesYearFeatures{
+		years:     make(map[string]int),
+		tolerance: tolerance,
+	}
+
+	for id, metadata := range m {
+		if !metadata.year.IsZero() {
+			features.years[id] = metadata.year.Year()
 		}
 	}
 
 	return features
 }
 
+type moviesYearFeatures struct {
+	// years is the release year of each movie by id
+	years     map[string]int
+	tolerance int
+}
+
 type movieMetadata struct {
 	title         string
 	originalTitle string
@@ -170,28 +303,36 @@ type movieMetadata struct {
 }
 
 func (m *movieMetadata) feature() *movieMetadataFeatures {
+	feature := m.companiesFeature()
+	if !m.year.IsZero() {
+		feature.tokens = append(feature.tokens, fmt.Sprintf("%d", m.year.Year()))
+	}
+	return feature
+}
+
+// companiesFeature returns the feature of the movie without its release year among the tokens, for when
+// the year is scored by the year feature
+func (m *movieMetadata) companiesFeature() *movieMetadataFeatures {
 	tokens := []string{}
 	for _, company := range m.production {
-		tokens = append(tokens, normaliseString(company))
-	}
-	if !m.year.IsZero() {
-		tokens = append(tokens, fmt.Sprintf("%d", m.year.Year()))
+		tokens = append(tokens, normaliseText(company))
 	}
 
 	return &movieMetadataFeatures{
-		title:         normaliseString(m.title),
-		originalTitle: normaliseString(m.originalTitle),
+		title:         normaliseText(m.title),
+		originalTitle: normaliseText(m.originalTitle),
 		tokens:        tokens,
 	}
 }
 
-func normaliseString(s string) string {
-	return strings.ToLower(strings.TrimSpace(s))
-}
-
 type moviesMetadataFeatures struct {
 	data map[string]*movieMetadataFeatures
 	trie *trieNode
+	// maxDistance is the maximum number of edits between the title of a movie and a Wikipedia title
+	// for the movie to be a candidate
+	maxDistance int
+	// titleBias is the weight of the title score in the relevance of a movie, with the rest given to its tokens
+	titleBias float64
 }
 
 type movieMetadataFeatures struct {
@@ -239,7 +380,7 @@ func readMoviesCredits(res moviesCredits) parseRowFn {
 
 		for columnName, idx := range indices {
 			if idx >= len(row) {
-				stats.rowErrors[stats.totalRows] = fmt.Errorf("row has %d columns when at least %d is expected", len(row), idx+1)
+				stats.addError(errorShortRow, columnName, "", fmt.Errorf("row has %d columns when at least %d is expected", len(row), idx+1))
 				return
 			}
 
@@ -281,11 +422,11 @@ func (m *movieCredits) feature() movieCreditsFeatures {
 	features := make([]string, 0, len(m.cast)+len(m.crew))
 
 	for _, c := range m.cast {
-		features = append(features, normaliseString(c))
+		features = append(features, normaliseText(c))
 	}
 
 	for _, c := range m.crew {
-		features = append(features, normaliseString(c))
+		features = append(features, normaliseText(c))
 	}
 
 	return features
@@ -295,34 +436,13 @@ type moviesCreditsFeatures map[string]movieCreditsFeatures
 
 type movieCreditsFeatures []string
 
-// readMoviesRating specifies how to read a row of data from the IMDB `ratings` file
-func readMoviesRating(res ratings) parseRowFn {
+// readMoviesRating specifies how to read a row of data from the IMDB `ratings` file, mapping the movie ids with `links`.
+// Duplicate ratings are found by keeping the users who rated each movie in memory.
+func readMoviesRating(res ratings, links movieLinks) parseRowFn {
 	return func(row []string, indices map[string]int, stats *outputStats) {
-		var id string
-		var rating float32
-		var userID string
-		var err error
-
-		for columnName, idx := range indices {
-			if idx >= len(row) {
-				stats.rowErrors[stats.totalRows] = fmt.Errorf("row has %d columns when at least %d is expected", len(row), idx+1)
-				return
-			}
-
-			columnValue := row[idx]
-
-			switch columnName {
-			case "movieId":
-				id = columnValue
-			case "userId":
-				userID = columnValue
-			case "rating":
-				rating, err = getFloat(columnValue)
-				if err != nil {
-					stats.rowErrors[stats.totalRows] = fmt.Errorf("column has value %q which cannot be converted to a float for ratings", columnValue)
-					return
-				}
-			}
+		id, userID, rating, ok := parseRating(row, indices, links, stats)
+		if !ok {
+			return
 		}
 
 		val, ok := res[id]
@@ -332,22 +452,101 @@ func readMoviesRating(res ratings) parseRowFn {
 			}
 		}
 
-		if userID == "" {
-			stats.rowErrors[stats.totalRows] = fmt.Errorf("userID is empty")
-			return
-		}
-
 		if val.seenUsers[userID] {
-			stats.rowErrors[stats.totalRows] = fmt.Errorf("userID %q already seen for id %q", userID, id)
+			stats.addError(errorDuplicate, "userId", userID, fmt.Errorf("userID %q already seen for id %q", userID, id))
 			return
 		}
-
-		val.numberOfRatings += 1
-		val.cumulativeRating += rating
 		val.seenUsers[userID] = true
 
 		if id != "" {
 			res[id] = val
+			res.add(id, rating)
+		}
+	}
+}
+
+// parseRating parses a row of the IMDB `ratings` file, returning false if the row has errors.
+// The MovieLens id of the movie is mapped to its TMDB id if `links` is not nil.
+func parseRating(row []string, indices map[string]int, links movieLinks, stats *outputStats) (string, string, float32, bool) {
+	var id string
+	var rating float32
+	var userID string
+	var err error
+
+	for columnName, idx := range indices {
+		if idx >= len(row) {
+			stats.addError(errorShortRow, columnName, "", fmt.Errorf("row has %d columns when at least %d is expected", len(row), idx+1))
+			return "", "", 0, false
+		}
+
+		columnValue := row[idx]
+
+		switch columnName {
+		case "movieId":
+			id = columnValue
+		case "userId":
+			userID = columnValue
+		case "rating":
+			rating, err = getFloat(columnValue)
+			if err != nil {
+				stats.addError(errorInvalidNumber, columnName, columnValue, fmt.Errorf("column has value %q which cannot be converted to a float for ratings", columnValue))
+				return "", "", 0, false
+			}
+		}
+	}
+
+	if userID == "" {
+		stats.addError(errorMissingValue, "userId", "", fmt.Errorf("userID is empty"))
+		return "", "", 0, false
+	}
+
+	if links != nil && id != "" {
+		tmdbID, ok := links[id]
+		if !ok {
+			stats.addError(errorUnmappedID, "movieId", id, fmt.Errorf("movieId %q has no TMDB id in the links file", id))
+			return "", "", 0, false
+		}
+		id = tmdbID
+	}
+
+	return id, userID, rating, true
+}
+
+// movieLinks maps the MovieLens ids used by the `ratings` file to the TMDB ids used by the `movies_metadata` file
+type movieLinks map[string]string
+
+// readMovieLinks specifies how to read a row of data from the IMDB `links` file.
+// Movies without a TMDB id are left out of the links.
+func readMovieLinks(res movieLinks) parseRowFn {
+	return func(row []string, indices map[string]int, stats *outputStats) {
+		var id, tmdbID string
+
+		for columnName, idx := range indices {
+			if idx >= len(row) {
+				stats.addError(errorShortRow, columnName, "", fmt.Errorf("row has %d columns when at least %d is expected", len(row), idx+1))
+				return
+			}
+
+			columnValue := row[idx]
+			switch columnName {
+			case "movieId":
+				id = columnValue
+			case "tmdbId":
+				if columnValue == "" {
+					continue
+				}
+				// Ids are formatted as in the movies metadata, without leading zeros
+				tmdb, err := getInt(columnValue)
+				if err != nil {
+					stats.addError(errorInvalidNumber, columnName, columnValue, fmt.Errorf("column has value %q which cannot be converted to an integer for TMDB id", columnValue))
+					return
+				}
+				tmdbID = strconv.Itoa(tmdb)
+			}
+		}
+
+		if id != "" && tmdbID != "" {
+			res[id] = tmdbID
 		}
 	}
 }
@@ -355,30 +554,59 @@ func readMoviesRating(res ratings) parseRowFn {
 type ratingInfo struct {
 	cumulativeRating float32
 	numberOfRatings  int
-	seenUsers        map[string]bool
+	// histogram counts the ratings of the movie by value, used for the median
+	histogram map[float32]int
+	// seenUsers are the users who rated the movie, when finding duplicate ratings in memory
+	seenUsers map[string]bool
 }
 
 type ratings map[string]*ratingInfo
 
-func (r ratings) forID(id string) string {
+// add adds a rating of the movie `id`
+func (r ratings) add(id string, rating float32) {
+	val, ok := r[id]
+	if !ok {
+		val = &ratingInfo{}
+		r[id] = val
+	}
+	if val.histogram == nil {
+		val.histogram = make(map[float32]int)
+	}
+
+	val.numberOfRatings += 1
+	val.cumulativeRating += rating
+	val.histogram[rating]++
+}
+
+// value returns the average rating for `id`, or nil if there are no ratings
+func (r ratings) value(id string) *float32 {
 	val, exists := r[id]
-	if !exists {
-		return "NaN"
+	if !exists || val.numberOfRatings == 0 {
+		return nil
 	}
 	avgRating := val.cumulativeRating / float32(val.numberOfRatings)
-	return fmt.Sprintf("%f", avgRating)
+	return &avgRating
+}
+
+// count returns the number of ratings of a movie
+func (r ratings) count(id string) int {
+	val, exists := r[id]
+	if !exists {
+		return 0
+	}
+	return val.numberOfRatings
 }
 
 // readMoviesRatio specifies how to read a row of data from a file containing budget to revenue ratio
 func readMoviesRatio(res moviesRatios) parseRowFn {
 	return func(row []string, indices map[string]int, stats *outputStats) {
 		var id string
-		var ratio float32
+		var ratio float64
 		var err error
 
 		for columnName, idx := range indices {
 			if idx >= len(row) {
-				stats.rowErrors[stats.totalRows] = fmt.Errorf("row has %d columns when at least %d is expected", len(row), idx+1)
+				stats.addError(errorShortRow, columnName, "", fmt.Errorf("row has %d columns when at least %d is expected", len(row), idx+1))
 				return
 			}
 
@@ -388,29 +616,32 @@ func readMoviesRatio(res moviesRatios) parseRowFn {
 			case "id":
 				id = columnValue
 			case "ratio":
-				ratio, err = getFloat(columnValue)
+				ratio, err = strconv.ParseFloat(columnValue, 64)
 				if err != nil {
-					stats.rowErrors[stats.totalRows] = fmt.Errorf("column has value %q which cannot be converted to a float for ratio", columnValue)
+					stats.addError(errorInvalidNumber, columnName, columnValue, fmt.Errorf("column has value %q which cannot be converted to a float for ratio", columnValue))
 					return
 				}
 			}
 		}
 
 		if id != "" {
-			res[id] = float32(ratio)
+			res[id] = ratio
 		}
 	}
 }
 
-type moviesRatios map[string]float32
+// moviesRatios are the revenue to budget ratios of movies by id, kept in full precision until written
+type moviesRatios map[string]float64
 
-func (m moviesRatios) forID(id string) string {
+// value returns the ratio for `id` as stored along with the other values of a movie, or nil if there is no ratio
+func (m moviesRatios) value(id string) *float32 {
 	ratio, ok := m[id]
 	if !ok {
-		return "NaN"
+		return nil
 	}
 
-	return fmt.Sprintf("%f", ratio)
+	value := float32(ratio)
+	return &value
 }
 
 // readCombinedData specifies how to read a row of data from a file containing all combined data
@@ -420,7 +651,7 @@ func readCombinedData(res map[string]*combinedData) parseRowFn {
 
 		for columnName, idx := range indices {
 			if idx >= len(row) {
-				stats.rowErrors[stats.totalRows] = fmt.Errorf("row has %d columns when at least %d is expected", len(row), idx+1)
+				stats.addError(errorShortRow, columnName, "", fmt.Errorf("row has %d columns when at least %d is expected", len(row), idx+1))
 				return
 			}
 
@@ -431,42 +662,74 @@ func readCombinedData(res map[string]*combinedData) parseRowFn {
 			case "title":
 				val.title = columnValue
 			case "year":
+				if columnValue == "" {
+					// Missing release date
+					continue
+				}
 				year, err := getTime(columnValue)
 				if err != nil {
-					stats.rowErrors[stats.totalRows] = fmt.Errorf("column has value %q which cannot be converted to a year", columnValue)
+					stats.addError(errorInvalidDate, columnName, columnValue, fmt.Errorf("column has value %q which cannot be converted to a year", columnValue))
 					return
 				}
 				val.year = year
 			case "budget":
 				budget, err := getInt(columnValue)
 				if err != nil {
-					stats.rowErrors[stats.totalRows] = fmt.Errorf("column has value %q which cannot be converted to an integer for budget", columnValue)
+					stats.addError(errorInvalidNumber, columnName, columnValue, fmt.Errorf("column has value %q which cannot be converted to an integer for budget", columnValue))
 					return
 				}
 				val.budget = budget
 			case "revenue":
 				revenue, err := getInt(columnValue)
 				if err != nil {
-					stats.rowErrors[stats.totalRows] = fmt.Errorf("column has value %q which cannot be converted to an integer for revenue", columnValue)
+					stats.addError(errorInvalidNumber, columnName, columnValue, fmt.Errorf("column has value %q which cannot be converted to an integer for revenue", columnValue))
 					return
 				}
 				val.revenue = revenue
 			case "ratio":
-				ratio, err := getFloat(columnValue)
+				ratio, err := getNullableFloat(columnValue)
 				if err != nil {
-					stats.rowErrors[stats.totalRows] = fmt.Errorf("column has value %q which cannot be converted to a float for ratio", columnValue)
+					stats.addError(errorInvalidNumber, columnName, columnValue, fmt.Errorf("column has value %q which cannot be converted to a float for ratio", columnValue))
 					return
 				}
 				val.ratio = ratio
 			case "rating":
-				rating, err := getFloat(columnValue)
+				rating, err := getNullableFloat(columnValue)
 				if err != nil {
-					stats.rowErrors[stats.totalRows] = fmt.Errorf("column has value %q which cannot be converted to a float for ratings", columnValue)
+					stats.addError(errorInvalidNumber, columnName, columnValue, fmt.Errorf("column has value %q which cannot be converted to a float for ratings", columnValue))
 					return
 				}
 				val.rating = rating
+			case "score":
+				score, err := getFloat(columnValue)
+				if err != nil {
+					stats.addError(errorInvalidNumber, columnName, columnValue, fmt.Errorf("column has value %q which cannot be converted to a float for score", columnValue))
+					return
+				}
+				val.score = score
+			case "rating_median":
+				median, err := getNullableFloat(columnValue)
+				if err != nil {
+					stats.addError(errorInvalidNumber, columnName, columnValue, fmt.Errorf("column has value %q which cannot be converted to a float for rating median", columnValue))
+					return
+				}
+				val.ratingMedian = median
+			case "weighted_rating":
+				weighted, err := getNullableFloat(columnValue)
+				if err != nil {
+					stats.addError(errorInvalidNumber, columnName, columnValue, fmt.Errorf("column has value %q which cannot be converted to a float for weighted rating", columnValue))
+					return
+				}
+				val.weightedRating = weighted
+			case "rating_count":
+				ratingCount, err := getInt(columnValue)
+				if err != nil {
+					stats.addError(errorInvalidNumber, columnName, columnValue, fmt.Errorf("column has value %q which cannot be converted to an integer for rating count", columnValue))
+					return
+				}
+				val.ratingCount = ratingCount
 			case "production_companies":
-				val.productionCompanies = strings.Split(columnValue, ";")
+				val.productionCompanies = splitList(columnValue)
 			case "url":
 				val.url = columnValue
 			case "abstract":
@@ -478,17 +741,22 @@ func readCombinedData(res map[string]*combinedData) parseRowFn {
 	}
 }
 
+// combinedData is a movie as written by `combine`, where the rating and ratio are nil when missing
 type combinedData struct {
 	id                  string
 	title               string
 	year                time.Time
-	rating              float32
+	rating              *float32
 	budget              int
 	revenue             int
-	ratio               float32
+	ratio               *float32
 	productionCompanies []string
 	url                 string
 	abstract            string
+	score               float32
+	ratingCount         int
+	ratingMedian        *float32
+	weightedRating      *float32
 }
 
 const (
@@ -511,7 +779,7 @@ func readWiki(wikiDecoder *xml.Decoder, movieEntries chan<- *wikiEntry) error {
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("could not get next token: %v", err)
+			return newWikiReadError(wikiDecoder, fmt.Errorf("could not get next token: %w", err))
 		}
 
 		switch t := token.(type) {
@@ -526,24 +794,23 @@ func readWiki(wikiDecoder *xml.Decoder, movieEntries chan<- *wikiEntry) error {
 			case tagTitle:
 				var title string
 				if err := wikiDecoder.DecodeElement(&title, &t); err != nil {
-					return fmt.Errorf("could not decode element: %v", err)
+					return newWikiReadError(wikiDecoder, fmt.Errorf("could not decode element: %w", err))
 				}
-				title = strings.TrimPrefix(title, "Wikipedia: ")
-				entry.title = title
+				entry.setTitle(strings.TrimPrefix(title, "Wikipedia: "))
 			case tagURL:
 				if err := wikiDecoder.DecodeElement(&entry.url, &t); err != nil {
-					return fmt.Errorf("could not decode element: %v", err)
+					return newWikiReadError(wikiDecoder, fmt.Errorf("could not decode element: %w", err))
 				}
 			case tagAbstract:
 				if err := wikiDecoder.DecodeElement(&entry.abstract, &t); err != nil {
-					return fmt.Errorf("could not decode element: %v", err)
+					return newWikiReadError(wikiDecoder, fmt.Errorf("could not decode element: %w", err))
 				}
 			case tagAnchor:
 				var anchor string
 				if err := wikiDecoder.DecodeElement(&anchor, &t); err != nil {
-					return fmt.Errorf("could not decode element: %v", err)
+					return newWikiReadError(wikiDecoder, fmt.Errorf("could not decode element: %w", err))
 				}
-				entry.anchors = append(entry.anchors, normaliseString(anchor))
+				entry.anchors = append(entry.anchors, normaliseText(anchor))
 			}
 		}
 	}
@@ -555,19 +822,132 @@ func readWiki(wikiDecoder *xml.Decoder, movieEntries chan<- *wikiEntry) error {
 	return nil
 }
 
+// readWikiAsync reads the Wikipedia XML file in a new goroutine. Movie entries are sent on the returned
+// entries channel, and the result of reading the file is sent on the returned error channel once
+// the entries channel has been closed.
+func readWikiAsync(wikiDecoder *xml.Decoder) (<-chan *wikiEntry, <-chan error) {
+	movieEntries := make(chan *wikiEntry, 1000)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- readWiki(wikiDecoder, movieEntries)
+	}()
+
+	return movieEntries, errc
+}
+
+// wikiReadError is returned when the Wikipedia XML file could not be read, along with where reading failed
+type wikiReadError struct {
+	// offset is the byte offset of the failure in the decompressed file
+	offset int64
+	// line is the line number of the failure if it is known, otherwise 0
+	line int
+	err  error
+}
+
+func newWikiReadError(wikiDecoder *xml.Decoder, err error) *wikiReadError {
+	res := &wikiReadError{
+		offset: wikiDecoder.InputOffset(),
+		err:    err,
+	}
+
+	var syntaxErr *xml.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		res.line = syntaxErr.Line
+	}
+
+	return res
+}
+
+func (w *wikiReadError) Error() string {
+	if w.line > 0 {
+		return fmt.Sprintf("error at line %d (byte offset %d): %v", w.line, w.offset, w.err)
+	}
+	return fmt.Sprintf("error at byte offset %d: %v", w.offset, w.err)
+}
+
+func (w *wikiReadError) Unwrap() error {
+	return w.err
+}
+
 type wikiEntry struct {
 	title    string
 	url      string
 	abstract string
 	anchors  []string
+	// baseTitle is the title without its disambiguator, such as "Heat" for "Heat (1995 film)"
+	baseTitle string
+	// year is the release year given by the disambiguator, or 0 if there is none
+	year int
+	// country is the nationality given by the disambiguator, such as "American", or empty if there is none
+	country string
 }
 
+// setTitle sets the title of the entry along with the base title, year and country parsed from its disambiguator
+func (w *wikiEntry) setTitle(title string) {
+	w.title = title
+	w.baseTitle, w.year, w.country = parseWikiTitle(title)
+}
+
+// lookupTitle returns the title used to find the movies of the entry, which is the base title if it is known
+func (w *wikiEntry) lookupTitle() string {
+	if w.baseTitle != "" {
+		return w.baseTitle
+	}
+	return w.title
+}
+
+var wikiDisambiguatorRegexp = regexp.MustCompile(`^(.+?)\s+\(([^()]+)\)$`)
+
+// filmKinds are the words describing the kind of film in a disambiguator, which are not part of its country
+var filmKinds = []string{"tv", "television", "short", "animated", "documentary", "silent", "feature"}
+
+// parseWikiTitle splits a Wikipedia title into its base title and the year and country of a film disambiguator,
+// such as "1995" for "Heat (1995 film)" and "American" for "Avatar (2009 American film)". Titles without
+// a film disambiguator are returned as they are.
+func parseWikiTitle(title string) (string, int, string) {
+	matches := wikiDisambiguatorRegexp.FindStringSubmatch(title)
+	if matches == nil {
+		return title, 0, ""
+	}
+
+	words := strings.Fields(matches[2])
+	last := strings.ToLower(words[len(words)-1])
+	if last != "film" && last != "movie" {
+		return title, 0, ""
+	}
+	words = words[:len(words)-1]
+
+	var year int
+	if len(words) > 0 && len(words[0]) == 4 {
+		if y, err := strconv.Atoi(words[0]); err == nil {
+			year = y
+			words = words[1:]
+		}
+	}
+
+	country := []string{}
+	for _, word := range words {
+		if contains(filmKinds, strings.ToLower(word)) || strings.HasSuffix(word, "-language") {
+			continue
+		}
+		// Anything other than a capitalised nationality means the disambiguator does not give a country
+		if r := []rune(word)[0]; !unicode.IsUpper(r) {
+			return matches[1], year, ""
+		}
+		country = append(country, word)
+	}
+
+	return matches[1], year, strings.Join(country, " ")
+}
+
+// isMovie returns whether the entry is about a movie, which is when its title has a film disambiguator
+// or its anchors are the sections of a film article
 func (w *wikiEntry) isMovie() bool {
 	if w == nil {
 		return false
 	}
 
-	if strings.Contains(normaliseString(w.title), "film)") {
+	if base, _, _ := parseWikiTitle(w.title); base != w.title {
 		return true
 	}
 
@@ -613,7 +993,7 @@ func readWikiMatches(res wikiMatches) parseRowFn {
 
 		for columnName, idx := range indices {
 			if idx >= len(row) {
-				stats.rowErrors[stats.totalRows] = fmt.Errorf("row has %d columns when at least %d is expected", len(row), idx+1)
+				stats.addError(errorShortRow, columnName, "", fmt.Errorf("row has %d columns when at least %d is expected", len(row), idx+1))
 				return
 			}
 
@@ -628,7 +1008,7 @@ func readWikiMatches(res wikiMatches) parseRowFn {
 			case "score":
 				score, err := getFloat(columnValue)
 				if err != nil {
-					stats.rowErrors[stats.totalRows] = fmt.Errorf("column has value %q which cannot be used as a float for score", columnValue)
+					stats.addError(errorInvalidNumber, columnName, columnValue, fmt.Errorf("column has value %q which cannot be used as a float for score", columnValue))
 					return
 				}
 				val.score = score
@@ -649,20 +1029,68 @@ type wikiMatch struct {
 	score    float32
 }
 
+// errorCategory groups parse errors by their cause
+type errorCategory string
+
+const (
+	errorCSVSyntax     errorCategory = "csv_syntax"
+	errorShortRow      errorCategory = "short_row"
+	errorInvalidNumber errorCategory = "invalid_number"
+	errorInvalidDate   errorCategory = "invalid_date"
+	errorMissingValue  errorCategory = "missing_value"
+	errorDuplicate     errorCategory = "duplicate"
+	errorInvalidList   errorCategory = "invalid_list"
+	errorUnmappedID    errorCategory = "unmapped_id"
+)
+
+// parseError is an error encountered when parsing a row of an input file
+type parseError struct {
+	row      int
+	category errorCategory
+	// column is the logical name of the column the error was found in, if known
+	column string
+	// value is the raw value which could not be parsed, if known
+	value string
+	err   error
+}
+
+func (p *parseError) Error() string {
+	return p.err.Error()
+}
+
 type outputStats struct {
 	inputFile string
 	totalRows int
-	// Each row will only have one error
-	rowErrors map[int]error
+	// Errors are ordered by the row they were found in
+	rowErrors []*parseError
 }
 
 func makeStats(inputFile string) *outputStats {
 	return &outputStats{
 		inputFile: inputFile,
-		rowErrors: make(map[int]error),
 	}
 }
 
+// addError records an error for the row currently being parsed
+func (o *outputStats) addError(category errorCategory, column, value string, err error) {
+	o.rowErrors = append(o.rowErrors, &parseError{
+		row:      o.totalRows,
+		category: category,
+		column:   column,
+		value:    value,
+		err:      err,
+	})
+}
+
+// categoryCounts returns the number of errors in each category
+func (o *outputStats) categoryCounts() map[errorCategory]int {
+	counts := make(map[errorCategory]int)
+	for _, err := range o.rowErrors {
+		counts[err.category]++
+	}
+	return counts
+}
+
 func (o *outputStats) String() string {
 	sBuilder := new(strings.Builder)
 	fmt.Fprintf(sBuilder, "A total of %d rows were parsed from %s. %d errors.\n",
@@ -671,10 +1099,20 @@ func (o *outputStats) String() string {
 		len(o.rowErrors),
 	)
 
+	counts := o.categoryCounts()
+	categories := make([]string, 0, len(counts))
+	for category := range counts {
+		categories = append(categories, string(category))
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		fmt.Fprintf(sBuilder, "  %s: %d\n", category, counts[errorCategory(category)])
+	}
+
 	if verboseErrors {
 		sBuilder.WriteString("Parse errors:\n")
-		for i, err := range o.rowErrors {
-			fmt.Fprintf(sBuilder, "error on row %d: %v\n", i, err)
+		for _, err := range o.rowErrors {
+			fmt.Fprintf(sBuilder, "error on row %d: %v\n", err.row, err)
 		}
 	} else {
 		sBuilder.WriteString("Run tool with -v flag to get verbose error outputs.\n")
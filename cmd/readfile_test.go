@@ -60,8 +60,12 @@ func Test_readRow(t *testing.T) {
 			outputStats: &outputStats{
 				inputFile: "test",
 				totalRows: 0,
-				rowErrors: map[int]error{
-					0: fmt.Errorf("could not parse line at 0 and column 0: extraneous or missing \" in quoted-field"),
+				rowErrors: []*parseError{
+					{
+						row:      0,
+						category: errorCSVSyntax,
+						err:      fmt.Errorf("could not parse line at 0 and column 0: extraneous or missing \" in quoted-field"),
+					},
 				},
 			},
 		},
@@ -87,15 +91,18 @@ func Test_readCSV(t *testing.T) {
 	tests := []struct {
 		name            string
 		in              string
-		columnNames     []string
+		columns         csvColumns
+		lenient         bool
+		mapping         columnMapping
 		expectedDataRow []string
 		expectedIndices map[string]int
+		wantErr         bool
 	}{
 		{
 			name: "subset of columns",
 			in: `id,revenue,budget,date
 1,100,10,2020`,
-			columnNames:     []string{"id", "date"},
+			columns:         csvColumns{required: []string{"id", "date"}},
 			expectedDataRow: []string{"1", "100", "10", "2020"},
 			expectedIndices: map[string]int{
 				"id":   0,
@@ -106,7 +113,7 @@ func Test_readCSV(t *testing.T) {
 			name: "all columns",
 			in: `id,revenue,budget,date
 1,100,10,2020`,
-			columnNames:     []string{"id", "date", "budget", "revenue"},
+			columns:         csvColumns{required: []string{"id", "date", "budget", "revenue"}},
 			expectedDataRow: []string{"1", "100", "10", "2020"},
 			expectedIndices: map[string]int{
 				"id":      0,
@@ -115,6 +122,60 @@ func Test_readCSV(t *testing.T) {
 				"revenue": 1,
 			},
 		},
+		{
+			name: "mapped columns",
+			in: `movie_id,revenue,budget,released
+1,100,10,2020`,
+			columns: csvColumns{required: []string{"id", "date", "budget"}},
+			mapping: columnMapping{
+				"id":   "movie_id",
+				"date": "released",
+			},
+			expectedDataRow: []string{"1", "100", "10", "2020"},
+			expectedIndices: map[string]int{
+				"id":     0,
+				"date":   3,
+				"budget": 2,
+			},
+		},
+		{
+			name: "missing column",
+			in: `id,revenue,budget
+1,100,10`,
+			columns: csvColumns{required: []string{"id", "date"}},
+			wantErr: true,
+		},
+		{
+			name: "missing mapped column",
+			in: `id,revenue,budget,date
+1,100,10,2020`,
+			columns: csvColumns{required: []string{"id", "date"}},
+			mapping: columnMapping{
+				"date": "released",
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing optional column",
+			in: `id,revenue,budget
+1,100,10`,
+			columns:         csvColumns{required: []string{"id"}, optional: []string{"date"}},
+			expectedDataRow: []string{"1", "100", "10"},
+			expectedIndices: map[string]int{
+				"id": 0,
+			},
+		},
+		{
+			name: "missing column in lenient mode",
+			in: `id,revenue,budget
+1,100,10`,
+			columns:         csvColumns{required: []string{"id", "date"}},
+			lenient:         true,
+			expectedDataRow: []string{"1", "100", "10"},
+			expectedIndices: map[string]int{
+				"id": 0,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -122,7 +183,13 @@ func Test_readCSV(t *testing.T) {
 			fin := csv.NewReader(strings.NewReader(test.in))
 			parseRow := expectedRowsIndices(t, test.expectedDataRow, test.expectedIndices)
 			stats := makeStats("test")
-			err := readCSV(fin, stats, test.columnNames, parseRow)
+			lenientColumns = test.lenient
+			defer func() { lenientColumns = false }()
+			err := readCSV(fin, stats, test.columns, test.mapping, parseRow)
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
 			require.NoError(t, err)
 			require.Empty(t, stats.rowErrors)
 		})
@@ -130,6 +197,30 @@ func Test_readCSV(t *testing.T) {
 
 }
 
+func Test_missingColumnsError(t *testing.T) {
+	// Reading the credits file when the movies metadata file is expected
+	fin := csv.NewReader(strings.NewReader(`cast,crew,id
+[],[],1`))
+	stats := makeStats("credits.csv")
+	err := readCSV(fin, stats, csvColumns{required: []string{"id", "title", "release_date"}}, columnMapping{"release_date": "released"}, nil)
+	require.Error(t, err)
+
+	missingErr, ok := err.(*missingColumnsError)
+	require.True(t, ok)
+	require.Equal(t, []missingColumn{
+		{name: "title", column: "title"},
+		{name: "release_date", column: "released"},
+	}, missingErr.missing)
+	require.Equal(t, `credits.csv is missing required columns: "title", "released" (mapped from "release_date"); the header contains "cast", "crew", "id"`, err.Error())
+
+	// Header columns with a similar name are suggested
+	fin = csv.NewReader(strings.NewReader(`ID,Title,budgets,revenue
+1,film,10,100`))
+	err = readCSV(fin, makeStats("test"), csvColumns{required: []string{"id", "title", "budget"}}, nil, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `"id" (did you mean "ID"?), "title" (did you mean "Title"?), "budget" (did you mean "budgets"?)`)
+}
+
 func expectedRowsIndices(t *testing.T, expectedRow []string, expectedIndices map[string]int) parseRowFn {
 	return func(row []string, indices map[string]int, stats *outputStats) {
 		// The order of elements matter in `row`
@@ -255,6 +346,11 @@ func Test_moviesMetadata(t *testing.T) {
 			require.Equal(t, test.out.title, f.title)
 			require.Equal(t, test.out.originalTitle, f.originalTitle)
 			require.ElementsMatch(t, test.out.tokens, f.tokens)
+
+			// The year is left out of the tokens when it is scored by the year feature
+			f = test.in.companiesFeature()
+			require.Equal(t, test.out.title, f.title)
+			require.NotContains(t, f.tokens, "2020")
 		})
 	}
 }
@@ -304,7 +400,7 @@ func Test_moviesMetadataParseFn(t *testing.T) {
 
 func Test_readMoviesRating(t *testing.T) {
 	ratingsRes := make(ratings)
-	parseFn := readMoviesRating(ratingsRes)
+	parseFn := readMoviesRating(ratingsRes, nil)
 	indices := map[string]int{
 		"movieId": 0,
 		"userId":  1,
@@ -328,7 +424,7 @@ func Test_readMoviesRating(t *testing.T) {
 	require.EqualValues(t, 22.0, ratingsRes["0"].cumulativeRating)
 	require.EqualValues(t, 4, ratingsRes["0"].numberOfRatings)
 	require.Len(t, ratingsRes["0"].seenUsers, 4)
-	require.Equal(t, fmt.Sprintf("%f", 5.5), ratingsRes.forID("0"))
+	require.Equal(t, float32Ptr(5.5), ratingsRes.value("0"))
 
 	// Repeated users
 	rows = [][]string{
@@ -344,10 +440,16 @@ func Test_readMoviesRating(t *testing.T) {
 
 	// Each duplictate row should give an error
 	require.Len(t, stats.rowErrors, 3)
+	for i, err := range stats.rowErrors {
+		require.Equal(t, errorDuplicate, err.category)
+		require.Equal(t, "U1", err.value)
+		require.Equal(t, 5+i, err.row)
+	}
 	require.EqualValues(t, 6.0, ratingsRes["1"].cumulativeRating)
 	require.EqualValues(t, 1, ratingsRes["1"].numberOfRatings)
 	require.Len(t, ratingsRes["1"].seenUsers, 1)
-	require.Equal(t, fmt.Sprintf("%f", 6.0), ratingsRes.forID("1"))
+	require.Equal(t, float32Ptr(6), ratingsRes.value("1"))
+	require.Nil(t, ratingsRes.value("2"))
 }
 
 func Test_readWiki(t *testing.T) {
@@ -374,10 +476,11 @@ func Test_readWiki(t *testing.T) {
 </doc>
 </feed>`,
 			out: &wikiEntry{
-				title:    "Anarchism (film)",
-				url:      "https://en.wikipedia.org/wiki/Anarchism",
-				abstract: "Anarchism is a political philosophy.",
-				anchors:  []string{"definition"},
+				title:     "Anarchism (film)",
+				url:       "https://en.wikipedia.org/wiki/Anarchism",
+				abstract:  "Anarchism is a political philosophy.",
+				anchors:   []string{"definition"},
+				baseTitle: "Anarchism",
 			},
 		},
 	}
@@ -393,3 +496,92 @@ func Test_readWiki(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseWikiTitle(t *testing.T) {
+	tests := []struct {
+		title   string
+		base    string
+		year    int
+		country string
+	}{
+		{title: "Heat (1995 film)", base: "Heat", year: 1995},
+		{title: "Alien (film)", base: "Alien"},
+		{title: "Avatar (2009 American film)", base: "Avatar", year: 2009, country: "American"},
+		{title: "Infernal Affairs (2002 Hong Kong film)", base: "Infernal Affairs", year: 2002, country: "Hong Kong"},
+		{title: "Duel (1971 TV film)", base: "Duel", year: 1971},
+		{title: "Vikram (2022 Indian Tamil-language film)", base: "Vikram", year: 2022, country: "Indian"},
+		{title: "Up (2009 animated film)", base: "Up", year: 2009},
+		{title: "The Godfather (film series)", base: "The Godfather (film series)"},
+		{title: "Heat (band)", base: "Heat (band)"},
+		{title: "Heat", base: "Heat"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			base, year, country := parseWikiTitle(test.title)
+			require.Equal(t, test.base, base)
+			require.Equal(t, test.year, year)
+			require.Equal(t, test.country, country)
+		})
+	}
+}
+
+func Test_isMovie(t *testing.T) {
+	tests := []struct {
+		name     string
+		entry    *wikiEntry
+		expected bool
+	}{
+		{name: "nil", entry: nil, expected: false},
+		{name: "disambiguator", entry: &wikiEntry{title: "Heat (1995 film)"}, expected: true},
+		{name: "uppercase disambiguator", entry: &wikiEntry{title: "Duel (1971 TV Film)"}, expected: true},
+		{name: "other disambiguator", entry: &wikiEntry{title: "Heat (band)"}, expected: false},
+		{name: "film series", entry: &wikiEntry{title: "The Godfather (film series)"}, expected: false},
+		{name: "anchors", entry: &wikiEntry{title: "Heat", anchors: []string{"plot", "cast", "production", "release"}}, expected: true},
+		{name: "few anchors", entry: &wikiEntry{title: "Heat", anchors: []string{"plot", "cast"}}, expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, test.entry.isMovie())
+		})
+	}
+
+	// Anchors are normalised like titles before being compared with the sections of a film article
+	decoder := xml.NewDecoder(strings.NewReader(`<feed><doc><title>Wikipedia: Heat</title>
+<links><sublink><anchor> Plot</anchor></sublink><sublink><anchor>Cast &amp; crew</anchor></sublink>
+<sublink><anchor>Production</anchor></sublink><sublink><anchor>Release</anchor></sublink></links></doc></feed>`))
+	outChan := make(chan *wikiEntry, 1)
+	require.NoError(t, readWiki(decoder, outChan))
+	entry := <-outChan
+	require.Equal(t, []string{"plot", "cast and crew", "production", "release"}, entry.anchors)
+}
+
+func Test_readWikiError(t *testing.T) {
+	in := `<feed>
+<doc>
+<title>Wikipedia: Film Foo (film)</title>
+<url>https://en.wikipedia.org/wiki/Film_Foo</url>
+</doc>
+<doc>
+<title>Wikipedia: Film Bar (film)</title>
+<url>https://en.wikipedia.org/wiki/Fi`
+
+	movieEntries, errc := readWikiAsync(xml.NewDecoder(strings.NewReader(in)))
+	entries := []*wikiEntry{}
+	for entry := range movieEntries {
+		entries = append(entries, entry)
+	}
+
+	// Entries read before the error are still sent
+	require.Len(t, entries, 1)
+	require.Equal(t, "Film Foo (film)", entries[0].title)
+
+	err := <-errc
+	require.Error(t, err)
+	readErr, ok := err.(*wikiReadError)
+	require.True(t, ok)
+	require.Equal(t, 8, readErr.line)
+	require.EqualValues(t, len(in), readErr.offset)
+	require.Contains(t, err.Error(), "error at line 8")
+}
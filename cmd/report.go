@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	errorsOut string
+
+	// parsedInputs holds the stats of every input read by the command
+	parsedInputs []*outputStats
+)
+
+// errorReportRow is a row of the parse error report
+type errorReportRow struct {
+	InputFile string        `json:"input_file"`
+	Row       int           `json:"row"`
+	Column    string        `json:"column"`
+	Value     string        `json:"value"`
+	Category  errorCategory `json:"category"`
+	Error     string        `json:"error"`
+}
+
+// writeErrorReport writes the parse errors of every input read by the command to the file at `path`.
+// The report is written as CSV if `path` has a `.csv` extension and as JSON Lines otherwise.
+func writeErrorReport(path string) error {
+	rows := []*errorReportRow{}
+	for _, stats := range parsedInputs {
+		errors := append([]*parseError{}, stats.rowErrors...)
+		sort.SliceStable(errors, func(i, j int) bool {
+			return errors[i].row < errors[j].row
+		})
+
+		for _, err := range errors {
+			rows = append(rows, &errorReportRow{
+				InputFile: stats.inputFile,
+				Row:       err.row,
+				Column:    err.column,
+				Value:     err.value,
+				Category:  err.category,
+				Error:     err.Error(),
+			})
+		}
+	}
+
+	write := writeErrorReportJSONL
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		write = writeErrorReportCSV
+	}
+
+	if err := writeFile(path, func(w io.Writer) error { return write(w, rows) }); err != nil {
+		return fmt.Errorf("could not write error report: %v", err)
+	}
+
+	fmt.Fprintf(logOutput, "%d parse errors written to %s\n", len(rows), path)
+	return nil
+}
+
+func writeErrorReportJSONL(w io.Writer, rows []*errorReportRow) error {
+	encoder := json.NewEncoder(w)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeErrorReportCSV(w io.Writer, rows []*errorReportRow) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"input_file", "row", "column", "value", "category", "error"}); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		writer.Write([]string{row.InputFile, strconv.Itoa(row.Row), row.Column, row.Value, string(row.Category), row.Error})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
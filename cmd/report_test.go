@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_writeErrorReport(t *testing.T) {
+	stats := makeStats("movies_metadata.csv")
+	stats.totalRows = 3
+	stats.addError(errorInvalidNumber, "budget", "ten", fmt.Errorf("not a number"))
+	stats.totalRows = 1
+	stats.addError(errorShortRow, "id", "", fmt.Errorf("row too short"))
+
+	parsedInputs = []*outputStats{stats}
+	defer func() { parsedInputs = nil }()
+
+	require.Equal(t, map[errorCategory]int{errorInvalidNumber: 1, errorShortRow: 1}, stats.categoryCounts())
+
+	tests := []struct {
+		name     string
+		file     string
+		expected string
+	}{
+		{
+			name: "json lines",
+			file: "errors.jsonl",
+			expected: `{"input_file":"movies_metadata.csv","row":1,"column":"id","value":"","category":"short_row","error":"row too short"}
+{"input_file":"movies_metadata.csv","row":3,"column":"budget","value":"ten","category":"invalid_number","error":"not a number"}
+`,
+		},
+		{
+			name: "csv",
+			file: "errors.csv",
+			expected: `input_file,row,column,value,category,error
+movies_metadata.csv,1,id,,short_row,row too short
+movies_metadata.csv,3,budget,ten,invalid_number,not a number
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), test.file)
+			require.NoError(t, writeErrorReport(path))
+
+			contents, err := ioutil.ReadFile(path)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, string(contents))
+		})
+	}
+}
+
+func Test_executeWritesReportOnError(t *testing.T) {
+	defer func() { parsedInputs, errorsOut = nil, "" }()
+	defer rootCmd.SetArgs(nil)
+
+	dir := t.TempDir()
+	wikiPath := filepath.Join(dir, "wiki.xml")
+	metadataPath := filepath.Join(dir, "movies_metadata.csv")
+	creditsPath := filepath.Join(dir, "credits.csv")
+	reportPath := filepath.Join(dir, "errors.jsonl")
+	require.NoError(t, ioutil.WriteFile(wikiPath, []byte("<feed><doc><title>Wikipedia: Film"), 0644))
+	require.NoError(t, ioutil.WriteFile(metadataPath, []byte("id,title,release_date\n1,Film Foo,not a date\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(creditsPath, []byte("id,cast,crew\n1,[],[]\n"), 0644))
+
+	// The metadata is read before the truncated Wikipedia file makes the command fail
+	rootCmd.SetArgs([]string{"match", wikiPath, metadataPath, creditsPath, "--output", filepath.Join(dir, "output_matching.csv"), "--errors-out", reportPath})
+	err := execute()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "could not read Wikipedia dataset")
+
+	contents, err := ioutil.ReadFile(reportPath)
+	require.NoError(t, err)
+	require.Contains(t, string(contents), `"input_file":"`+metadataPath+`"`)
+	require.Contains(t, string(contents), `"column":"release_date"`)
+}
@@ -10,6 +10,17 @@ import (
 var (
 	rootCmd = &cobra.Command{
 		Short: "A tool for deriving movie analytics",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Keep stdout for the output of the command
+			if output := cmd.Flags().Lookup("output"); output != nil && output.Value.String() == stdoutPath {
+				logOutput = os.Stderr
+			}
+			if errorsOut == stdoutPath {
+				logOutput = os.Stderr
+			}
+
+			return loadColumnMappings()
+		},
 	}
 
 	verboseErrors bool
@@ -20,13 +31,42 @@ func init() {
 	rootCmd.AddCommand(matchCmd)
 	rootCmd.AddCommand(combineCmd)
 	rootCmd.AddCommand(loadCmd)
+	rootCmd.AddCommand(pipelineCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(migrateCmd)
 
 	rootCmd.PersistentFlags().BoolVarP(&verboseErrors, "verbose", "v", false, "output verbose errors")
+	rootCmd.PersistentFlags().StringVar(&outDir, "out-dir", "", "directory relative output paths are written to")
+	rootCmd.PersistentFlags().StringVar(&errorsOut, "errors-out", "", "write a report of all parse errors to a file, as CSV if it has a .csv extension and JSON Lines otherwise, or - for stdout")
+	rootCmd.PersistentFlags().BoolVar(&lenientColumns, "lenient", false, "ignore required columns which are missing from a file header")
+	rootCmd.PersistentFlags().StringVar(&columnsFile, "columns-file", "", "YAML or JSON file mapping the column names of each dataset")
+	rootCmd.PersistentFlags().StringToStringVar(&metadataColumns, "metadata-columns", nil, "column names of the movies metadata dataset, e.g. id=tmdb_id,release_date=released")
+	rootCmd.PersistentFlags().StringToStringVar(&creditsColumns, "credits-columns", nil, "column names of the credits dataset, e.g. cast=cast_json")
+	rootCmd.PersistentFlags().StringToStringVar(&ratingsColumns, "ratings-columns", nil, "column names of the ratings dataset, e.g. movieId=movie_id")
+	rootCmd.PersistentFlags().StringToStringVar(&linksColumns, "links-columns", nil, "column names of the links dataset, e.g. tmdbId=tmdb_id")
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	if err := execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
+
+// execute runs the root command and writes the parse error report if one was asked for. The report is
+// also written when the command fails, as the parse errors may be what made it fail.
+func execute() error {
+	err := rootCmd.Execute()
+	if errorsOut == "" {
+		return err
+	}
+
+	if reportErr := writeErrorReport(errorsOut); reportErr != nil {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, reportErr)
+			return err
+		}
+		return reportErr
+	}
+	return err
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	featureMetadata = "metadata"
+	featureCredits  = "credits"
+	featureYear     = "year"
+)
+
+// featureNames are the names of the features scoring Wikipedia entries against movies
+var featureNames = []string{featureMetadata, featureCredits, featureYear}
+
+var (
+	scoringFile      string
+	featureWeights   map[string]string
+	disabledFeatures []string
+	titleBias        float64
+	minScore         float64
+
+	// matchScoring is the scoring config used for matching
+	matchScoring = defaultScoringConfig()
+)
+
+// addScoringFlags adds the flags configuring how Wikipedia entries are scored against movies to a command
+func addScoringFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&scoringFile, "scoring-file", "", "YAML or JSON file configuring how Wikipedia entries are scored, such as the scoring file written along with the matches")
+	cmd.Flags().StringToStringVar(&featureWeights, "feature-weights", nil, "weight of each feature in the score of a match, e.g. metadata=2,credits=1,year=0.5")
+	cmd.Flags().StringSliceVar(&disabledFeatures, "disable-features", []string{featureYear}, "features which do not add to the score of a match, any of credits and year, or an empty list to enable all features")
+	cmd.Flags().Float64Var(&titleBias, "title-bias", 0.5, "weight of the title in the metadata score between 0 and 1, with the rest given to the production companies")
+	cmd.Flags().Float64Var(&minScore, "min-score", 0, "minimum score between 0 and 1 for a Wikipedia entry to be matched to a movie")
+}
+
+// scoringConfig configures how Wikipedia entries are scored against movies. The score of a match is the mean
+// of the scores of the enabled features weighted by their weights, and entries with a score of 0 or below
+// `MinScore` are not matched. It also holds the settings of the features which change their scores, so that
+// a written config reproduces the scores of the matches.
+type scoringConfig struct {
+	Weights          map[string]float64 `yaml:"weights"`
+	Disabled         []string           `yaml:"disabled"`
+	TitleBias        float64            `yaml:"title_bias"`
+	MinScore         float64            `yaml:"min_score"`
+	MaxTitleDistance int                `yaml:"max_title_distance"`
+	YearTolerance    int                `yaml:"year_tolerance"`
+	Normalise        []string           `yaml:"normalise"`
+}
+
+func defaultScoringConfig() scoringConfig {
+	config := scoringConfig{
+		Weights:       make(map[string]float64),
+		Disabled:      []string{featureYear},
+		TitleBias:     0.5,
+		YearTolerance: 1,
+		Normalise:     normaliseSteps,
+	}
+	for _, name := range featureNames {
+		config.Weights[name] = 1
+	}
+	return config
+}
+
+// loadScoringConfig returns the scoring config given by the scoring file and the flags of `cmd`.
+// Values given by flags take precedence over the file.
+func loadScoringConfig(cmd *cobra.Command) (scoringConfig, error) {
+	config := defaultScoringConfig()
+	if scoringFile != "" {
+		contents, err := ioutil.ReadFile(scoringFile)
+		if err != nil {
+			return scoringConfig{}, fmt.Errorf("could not read scoring file: %v", err)
+		}
+
+		// Values missing from the file, including the weights of features it does not give, keep their defaults.
+		// JSON is valid YAML so both formats can be parsed with the same decoder.
+		weights := config.Weights
+		config.Weights = nil
+		if err := yaml.UnmarshalStrict(contents, &config); err != nil {
+			return scoringConfig{}, fmt.Errorf("could not parse scoring file %q: %v", scoringFile, err)
+		}
+		for name, weight := range config.Weights {
+			weights[name] = weight
+		}
+		config.Weights = weights
+	}
+
+	for name, value := range featureWeights {
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return scoringConfig{}, fmt.Errorf("--feature-weights has value %q for %q when a number is expected", value, name)
+		}
+		config.Weights[name] = weight
+	}
+	if cmd.Flags().Changed("disable-features") {
+		config.Disabled = disabledFeatures
+	}
+	if cmd.Flags().Changed("title-bias") {
+		config.TitleBias = titleBias
+	}
+	if cmd.Flags().Changed("min-score") {
+		config.MinScore = minScore
+	}
+	if cmd.Flags().Changed("max-title-distance") {
+		config.MaxTitleDistance = maxTitleDistance
+	}
+	if cmd.Flags().Changed("year-tolerance") {
+		config.YearTolerance = yearTolerance
+	}
+	if cmd.Flags().Changed("normalise") {
+		config.Normalise = normaliseFlag
+	}
+
+	return config, config.validate()
+}
+
+func (s scoringConfig) validate() error {
+	for name, weight := range s.Weights {
+		if !contains(featureNames, name) {
+			return fmt.Errorf("unknown feature %q, expected one of %s", name, strings.Join(featureNames, ", "))
+		}
+		if weight < 0 {
+			return fmt.Errorf("feature %q has weight %v when a weight of at least 0 is expected", name, weight)
+		}
+	}
+
+	for _, name := range s.Disabled {
+		if !contains(featureNames, name) {
+			return fmt.Errorf("unknown feature %q, expected one of %s", name, strings.Join(featureNames, ", "))
+		}
+	}
+	// Candidate movies are found by their titles so the metadata feature is always needed
+	if !s.enabled(featureMetadata) {
+		return fmt.Errorf("feature %q finds the movies relevant to a Wikipedia entry and cannot be disabled", featureMetadata)
+	}
+
+	var total float64
+	for _, name := range featureNames {
+		if s.enabled(name) {
+			total += s.Weights[name]
+		}
+	}
+	if total <= 0 {
+		return fmt.Errorf("the enabled features have a total weight of %v when a weight above 0 is expected", total)
+	}
+
+	if s.TitleBias < 0 || s.TitleBias > 1 {
+		return fmt.Errorf("title bias has value %v when a value between 0 and 1 is expected", s.TitleBias)
+	}
+	if s.MinScore < 0 || s.MinScore > 1 {
+		return fmt.Errorf("minimum score has value %v when a value between 0 and 1 is expected", s.MinScore)
+	}
+	if s.MaxTitleDistance < 0 {
+		return fmt.Errorf("maximum title distance has value %d when a number of edits of at least 0 is expected", s.MaxTitleDistance)
+	}
+	if s.YearTolerance < 0 {
+		return fmt.Errorf("year tolerance has value %d when a number of years of at least 0 is expected", s.YearTolerance)
+	}
+	if _, err := newNormaliser(s.Normalise); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s scoringConfig) enabled(name string) bool {
+	return !contains(s.Disabled, name)
+}
+
+// accepts returns whether an entry with the given score is matched
+func (s scoringConfig) accepts(score float64) bool {
+	return score > 0 && score >= s.MinScore
+}
+
+// write writes the config as YAML, which can be read back with the --scoring-file flag
+func (s scoringConfig) write(w io.Writer) error {
+	contents, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(contents)
+	return err
+}
+
+// scoringFilePath returns the path of the scoring file written along with the matches written to `path`
+func scoringFilePath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".scoring.yaml"
+}
+
+// weightedFeature is a feature along with the weight of its score
+type weightedFeature struct {
+	matching
+	weight float64
+}
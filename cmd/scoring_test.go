@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_loadScoringConfig(t *testing.T) {
+	defer resetMatchFlags()
+
+	path := filepath.Join(t.TempDir(), "scoring.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("weights:\n  credits: 2\ndisabled: [year]\nmin_score: 0.25\nyear_tolerance: 2\nnormalise: [fold]\n"), 0644))
+
+	tests := []struct {
+		name     string
+		file     string
+		args     []string
+		expected scoringConfig
+		err      bool
+	}{
+		{
+			name:     "defaults",
+			expected: scoringConfig{Weights: map[string]float64{"metadata": 1, "credits": 1, "year": 1}, Disabled: []string{"year"}, TitleBias: 0.5, YearTolerance: 1, Normalise: normaliseSteps},
+		},
+		{
+			name:     "all features enabled",
+			args:     []string{"--disable-features="},
+			expected: scoringConfig{Weights: map[string]float64{"metadata": 1, "credits": 1, "year": 1}, Disabled: []string{}, TitleBias: 0.5, YearTolerance: 1, Normalise: normaliseSteps},
+		},
+		{
+			name:     "file",
+			file:     path,
+			expected: scoringConfig{Weights: map[string]float64{"metadata": 1, "credits": 2, "year": 1}, Disabled: []string{"year"}, TitleBias: 0.5, MinScore: 0.25, YearTolerance: 2, Normalise: []string{"fold"}},
+		},
+		{
+			name:     "flags take precedence over the file",
+			file:     path,
+			args:     []string{"--feature-weights", "credits=0.5,year=3", "--disable-features", "credits", "--title-bias", "0.8", "--max-title-distance", "1", "--normalise", "none"},
+			expected: scoringConfig{Weights: map[string]float64{"metadata": 1, "credits": 0.5, "year": 3}, Disabled: []string{"credits"}, TitleBias: 0.8, MinScore: 0.25, MaxTitleDistance: 1, YearTolerance: 2, Normalise: []string{"none"}},
+		},
+		{name: "unknown feature", args: []string{"--feature-weights", "genre=1"}, err: true},
+		{name: "invalid weight", args: []string{"--feature-weights", "credits=high"}, err: true},
+		{name: "negative weight", args: []string{"--feature-weights", "credits=-1"}, err: true},
+		{name: "metadata disabled", args: []string{"--disable-features", "metadata"}, err: true},
+		{name: "no weight", args: []string{"--feature-weights", "metadata=0,credits=0", "--disable-features", "year"}, err: true},
+		{name: "title bias", args: []string{"--title-bias", "1.5"}, err: true},
+		{name: "minimum score", args: []string{"--min-score", "-0.1"}, err: true},
+		{name: "maximum title distance", args: []string{"--max-title-distance", "-1"}, err: true},
+		{name: "year tolerance", args: []string{"--year-tolerance", "-1"}, err: true},
+		{name: "normalisation step", args: []string{"--normalise", "stem"}, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			addMatchFlags(cmd)
+			require.NoError(t, cmd.ParseFlags(append(test.args, "--scoring-file", test.file)))
+
+			config, err := loadScoringConfig(cmd)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, config)
+
+			// The written config is read back as the same config
+			var buf bytes.Buffer
+			require.NoError(t, config.write(&buf))
+			written := filepath.Join(t.TempDir(), "written.yaml")
+			require.NoError(t, ioutil.WriteFile(written, buf.Bytes(), 0644))
+
+			cmd = &cobra.Command{}
+			addMatchFlags(cmd)
+			require.NoError(t, cmd.ParseFlags([]string{"--scoring-file", written}))
+			featureWeights = nil
+			readBack, err := loadScoringConfig(cmd)
+			require.NoError(t, err)
+			require.Equal(t, config, readBack)
+		})
+	}
+}
+
+func Test_scoreEntryWeights(t *testing.T) {
+	mdFeatures := &moviesMetadataFeatures{
+		data: map[string]*movieMetadataFeatures{
+			"0": {title: "heat", tokens: []string{"warner bros"}},
+			"1": {title: "heat", tokens: []string{"new world pictures"}},
+		},
+		trie:      newTrie(),
+		titleBias: 0.5,
+	}
+	mdFeatures.trie.put([]rune("heat"), "0")
+	mdFeatures.trie.put([]rune("heat"), "1")
+	credits := moviesCreditsFeatures{"1": {"burt reynolds"}}
+
+	entry := &wikiEntry{abstract: "Heat is a 1995 film by Warner Bros. starring Al Pacino and Burt Reynolds"}
+	entry.setTitle("Heat (1995 film)")
+
+	config := defaultScoringConfig()
+	features := []weightedFeature{{matching: mdFeatures, weight: 1}, {matching: credits, weight: 1}}
+
+	// Movie 1 matches the credits and half the metadata
+	scored := scoreEntry(entry, features, config)
+	require.Equal(t, "1", scored.id)
+	require.Equal(t, 0.75, scored.result.score)
+
+	// Without the credits movie 0 matches all of the metadata
+	features[1].weight = 0
+	scored = scoreEntry(entry, features, config)
+	require.Equal(t, "0", scored.id)
+	require.Equal(t, 1.0, scored.result.score)
+
+	// Only the title counts without a bias towards the tokens
+	mdFeatures.titleBias = 1
+	features[1].weight = 3
+	scored = scoreEntry(entry, features, config)
+	require.Equal(t, "1", scored.id)
+	require.Equal(t, 1.0, scored.result.score)
+
+	// Entries scoring below the minimum are not matched
+	mdFeatures.titleBias = 0
+	features[1].weight = 1
+	config.MinScore = 0.6
+	require.Nil(t, scoreEntry(entry, features, config))
+	config.MinScore = 0.5
+	require.NotNil(t, scoreEntry(entry, features, config))
+}
+
+func Test_configureMatchingRoundTrip(t *testing.T) {
+	defer resetMatchFlags()
+
+	cmd := &cobra.Command{}
+	addMatchFlags(cmd)
+	require.NoError(t, cmd.ParseFlags([]string{
+		"--feature-weights", "credits=2", "--disable-features", "year", "--title-bias", "0.7", "--min-score", "0.3",
+		"--max-title-distance", "2", "--year-tolerance", "3", "--normalise", "punctuation,fold",
+	}))
+	require.NoError(t, configureMatching(cmd))
+	written := matchScoring
+	// Normalisation steps are written in the order they are applied
+	require.Equal(t, []string{normaliseFold, normalisePunctuation}, written.Normalise)
+
+	path := filepath.Join(t.TempDir(), "output_matching.scoring.yaml")
+	require.NoError(t, writeFile(path, written.write))
+
+	// Reading the written config back without any other flags gives the same config and normaliser
+	resetMatchFlags()
+	cmd = &cobra.Command{}
+	addMatchFlags(cmd)
+	require.NoError(t, cmd.ParseFlags([]string{"--scoring-file", path}))
+	require.NoError(t, configureMatching(cmd))
+	require.Equal(t, written, matchScoring)
+	require.Equal(t, []string{normaliseFold, normalisePunctuation}, textNormaliser.steps)
+	require.Equal(t, scoringConfig{
+		Weights:          map[string]float64{"metadata": 1, "credits": 2, "year": 1},
+		Disabled:         []string{"year"},
+		TitleBias:        0.7,
+		MinScore:         0.3,
+		MaxTitleDistance: 2,
+		YearTolerance:    3,
+		Normalise:        []string{normaliseFold, normalisePunctuation},
+	}, matchScoring)
+}
+
+// resetMatchFlags resets the flags added by `addMatchFlags` and the config they set
+func resetMatchFlags() {
+	scoringFile, featureWeights, disabledFeatures = "", nil, nil
+	matchScoring = defaultScoringConfig()
+	textNormaliser = normaliser{steps: normaliseSteps}
+}
@@ -0,0 +1,370 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveCmd = &cobra.Command{
+		Use:     "serve --db <connection_uri>",
+		Example: "serve --db postgres://localhost/movies --addr :8080",
+		Short:   "Serve an HTTP API for querying the movies loaded to a Postgres database",
+		RunE:    serve,
+		Args:    cobra.NoArgs,
+	}
+
+	serveDB   string
+	serveAddr string
+)
+
+func init() {
+	serveCmd.Flags().StringVar(&serveDB, "db", "", "connection URI of the database the movies were loaded to")
+	serveCmd.Flags().StringVar(&serveAddr, "addr", ":8080", "address to listen on")
+	serveCmd.MarkFlagRequired("db")
+}
+
+func serve(cmd *cobra.Command, args []string) error {
+	db, err := connect(serveDB)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	server := &http.Server{
+		Addr:              serveAddr,
+		Handler:           newMoviesHandler(&postgresStore{db: db}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	fmt.Fprintf(logOutput, "Listening on %s\n", serveAddr)
+	return server.ListenAndServe()
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+)
+
+// sortColumns are the columns movies can be sorted by
+var sortColumns = []string{"rank", "budget", "revenue", "ratio", "rating", "year"}
+
+// errMovieNotFound is returned by a `movieStore` when there is no movie with a given id
+var errMovieNotFound = errors.New("movie not found")
+
+// movieStore provides access to the movies loaded by the `load` command
+type movieStore interface {
+	// movies calls `fn` for each movie matching the query, in the order given by the query
+	movies(ctx context.Context, q *movieQuery, fn func(*movie) error) error
+	// movie returns the movie with the given id or `errMovieNotFound`
+	movie(ctx context.Context, id int) (*movie, error)
+}
+
+// movieQuery specifies which movies are returned by `movieStore.movies`
+type movieQuery struct {
+	order sortOrder
+	// yearFrom and yearTo give the range of release years (inclusive), 0 if not set
+	yearFrom int
+	yearTo   int
+	// company only includes movies with the given production company if set
+	company string
+	// minRating only includes movies with at least the given rating if set
+	minRating *float64
+	limit     int
+	offset    int
+}
+
+// parseMovieQuery parses the query parameters of a `GET /movies` request
+func parseMovieQuery(values url.Values) (*movieQuery, error) {
+	q := &movieQuery{
+		order:   sortOrder{column: "ratio", descending: true},
+		company: values.Get("company"),
+		limit:   defaultPageSize,
+	}
+
+	if s := values.Get("sort"); s != "" {
+		order, err := outputSortOrder(s, sortColumns)
+		if err != nil {
+			return nil, err
+		}
+		q.order = order
+	}
+
+	intParams := []struct {
+		name string
+		dest *int
+		min  int
+		max  int
+	}{
+		{name: "year_from", dest: &q.yearFrom, min: 1, max: 9999},
+		{name: "year_to", dest: &q.yearTo, min: 1, max: 9999},
+		{name: "limit", dest: &q.limit, min: 1, max: maxPageSize},
+		{name: "offset", dest: &q.offset, min: 0, max: math.MaxInt32},
+	}
+	for _, param := range intParams {
+		s := values.Get(param.name)
+		if s == "" {
+			continue
+		}
+
+		v, err := strconv.Atoi(s)
+		if err != nil || v < param.min || v > param.max {
+			return nil, fmt.Errorf("%s has value %q when an integer between %d and %d is expected", param.name, s, param.min, param.max)
+		}
+		*param.dest = v
+	}
+
+	if s := values.Get("min_rating"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(v) {
+			return nil, fmt.Errorf("min_rating has value %q when a number is expected", s)
+		}
+		q.minRating = &v
+	}
+
+	return q, nil
+}
+
+// movie is a movie as returned by the API
+type movie struct {
+	ID                  int      `json:"id"`
+	Rank                *int     `json:"rank"`
+	Title               string   `json:"title"`
+	Year                string   `json:"year,omitempty"`
+	Rating              *float64 `json:"rating"`
+	Budget              int64    `json:"budget"`
+	Revenue             int64    `json:"revenue"`
+	Ratio               *float64 `json:"ratio"`
+	ProductionCompanies []string `json:"production_companies"`
+	URL                 string   `json:"url"`
+	Abstract            string   `json:"abstract"`
+}
+
+// moviesHandler serves the API for querying movies
+type moviesHandler struct {
+	store movieStore
+	mux   *http.ServeMux
+}
+
+func newMoviesHandler(store movieStore) *moviesHandler {
+	h := &moviesHandler{
+		store: store,
+		mux:   http.NewServeMux(),
+	}
+	h.mux.HandleFunc("/movies", h.listMovies)
+	h.mux.HandleFunc("/movies/", h.getMovie)
+
+	return h
+}
+
+func (h *moviesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+
+	h.mux.ServeHTTP(w, r)
+}
+
+// listMovies handles `GET /movies`. Movies are written to the response as they are read from the store.
+func (h *moviesHandler) listMovies(w http.ResponseWriter, r *http.Request) {
+	q, err := parseMovieQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// The response is only started once the first movie has been read so that errors
+	// querying the store can still be returned with an error status
+	started := false
+	start := func() {
+		if started {
+			return
+		}
+		started = true
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"limit":%d,"offset":%d,"movies":[`, q.limit, q.offset)
+	}
+
+	encoder := json.NewEncoder(w)
+	first := true
+	err = h.store.movies(r.Context(), q, func(m *movie) error {
+		start()
+		if !first {
+			if _, err := w.Write([]byte(",")); err != nil {
+				return err
+			}
+		}
+		first = false
+		return encoder.Encode(m)
+	})
+	if err != nil {
+		if !started {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		// The response is left incomplete so that clients cannot mistake it for a complete response
+		fmt.Fprintf(logOutput, "error writing movies: %v\n", err)
+		return
+	}
+
+	start()
+	w.Write([]byte("]}\n"))
+}
+
+// getMovie handles `GET /movies/{id}`
+func (h *moviesHandler) getMovie(w http.ResponseWriter, r *http.Request) {
+	s := strings.TrimPrefix(r.URL.Path, "/movies/")
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("movie id %q is not an integer", s))
+		return
+	}
+
+	m, err := h.store.movie(r.Context(), id)
+	if err == errMovieNotFound {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// postgresStore reads movies from the `topmovies` table
+type postgresStore struct {
+	db *sql.DB
+}
+
+var _ movieStore = (*postgresStore)(nil)
+
+const selectMoviesStmt = `
+SELECT id, rank, title, year, rating, budget, revenue, ratio, production_companies, url, abstract
+FROM topmovies`
+
+func (p *postgresStore) movies(ctx context.Context, q *movieQuery, fn func(*movie) error) error {
+	conditions := []string{}
+	args := []interface{}{}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if q.yearFrom > 0 {
+		addCondition("EXTRACT(YEAR FROM year) >= $%d", q.yearFrom)
+	}
+	if q.yearTo > 0 {
+		addCondition("EXTRACT(YEAR FROM year) <= $%d", q.yearTo)
+	}
+	if q.company != "" {
+		addCondition("$%d = ANY(production_companies)", q.company)
+	}
+	if q.minRating != nil {
+		addCondition("rating >= $%d", *q.minRating)
+	}
+
+	stmt := new(strings.Builder)
+	stmt.WriteString(selectMoviesStmt)
+	if len(conditions) > 0 {
+		fmt.Fprintf(stmt, "\nWHERE %s", strings.Join(conditions, " AND "))
+	}
+
+	// The sort column is one of `sortColumns` so it is safe to use in the statement
+	direction := "ASC"
+	if q.order.descending {
+		direction = "DESC"
+	}
+	fmt.Fprintf(stmt, "\nORDER BY %s %s NULLS LAST, id", q.order.column, direction)
+
+	args = append(args, q.limit, q.offset)
+	fmt.Fprintf(stmt, "\nLIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := p.db.QueryContext(ctx, stmt.String(), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := scanMovie(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (p *postgresStore) movie(ctx context.Context, id int) (*movie, error) {
+	row := p.db.QueryRowContext(ctx, selectMoviesStmt+"\nWHERE id = $1", id)
+	m, err := scanMovie(row)
+	if err == sql.ErrNoRows {
+		return nil, errMovieNotFound
+	}
+
+	return m, err
+}
+
+// scanMovie reads a movie from a row selected by `selectMoviesStmt`
+func scanMovie(row interface{ Scan(...interface{}) error }) (*movie, error) {
+	m := new(movie)
+	var year sql.NullTime
+	var rating, ratio sql.NullFloat64
+	var rank, budget, revenue sql.NullInt64
+	var title, wikiURL, abstract sql.NullString
+
+	err := row.Scan(&m.ID, &rank, &title, &year, &rating, &budget, &revenue, &ratio, pq.Array(&m.ProductionCompanies), &wikiURL, &abstract)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Title, m.URL, m.Abstract = title.String, wikiURL.String, abstract.String
+	m.Budget, m.Revenue = budget.Int64, revenue.Int64
+	if rank.Valid {
+		r := int(rank.Int64)
+		m.Rank = &r
+	}
+	if year.Valid && !year.Time.IsZero() {
+		m.Year = year.Time.Format("2006-01-02")
+	}
+	m.Rating = nullableFloat(rating)
+	m.Ratio = nullableFloat(ratio)
+	if m.ProductionCompanies == nil {
+		m.ProductionCompanies = []string{}
+	}
+
+	return m, nil
+}
+
+// nullableFloat returns nil for NULL and NaN values, which cannot be represented in JSON
+func nullableFloat(f sql.NullFloat64) *float64 {
+	if !f.Valid || math.IsNaN(f.Float64) {
+		return nil
+	}
+	return &f.Float64
+}
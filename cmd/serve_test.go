@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore is a `movieStore` holding movies in memory
+type memoryStore struct {
+	data []*movie
+	err  error
+}
+
+var _ movieStore = (*memoryStore)(nil)
+
+func (m *memoryStore) movies(ctx context.Context, q *movieQuery, fn func(*movie) error) error {
+	if m.err != nil {
+		return m.err
+	}
+
+	res := []*movie{}
+	for _, d := range m.data {
+		year, _ := strconv.Atoi(d.Year[:4])
+		if (q.yearFrom > 0 && year < q.yearFrom) || (q.yearTo > 0 && year > q.yearTo) {
+			continue
+		}
+		if q.company != "" && !contains(d.ProductionCompanies, q.company) {
+			continue
+		}
+		if q.minRating != nil && (d.Rating == nil || *d.Rating < *q.minRating) {
+			continue
+		}
+		res = append(res, d)
+	}
+
+	value := func(d *movie) string {
+		switch q.order.column {
+		case "rank":
+			if d.Rank != nil {
+				return fmt.Sprint(*d.Rank)
+			}
+		case "budget":
+			return fmt.Sprint(d.Budget)
+		case "revenue":
+			return fmt.Sprint(d.Revenue)
+		case "rating":
+			if d.Rating != nil {
+				return fmt.Sprint(*d.Rating)
+			}
+		case "ratio":
+			if d.Ratio != nil {
+				return fmt.Sprint(*d.Ratio)
+			}
+		case "year":
+			return d.Year
+		}
+		return ""
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return compareValues(value(res[i]), value(res[j]), q.order.descending) < 0
+	})
+
+	for i := q.offset; i < len(res) && i < q.offset+q.limit; i++ {
+		if err := fn(res[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) movie(ctx context.Context, id int) (*movie, error) {
+	for _, d := range m.data {
+		if d.ID == id {
+			return d, nil
+		}
+	}
+	return nil, errMovieNotFound
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func Test_moviesHandler(t *testing.T) {
+	store := &memoryStore{
+		data: []*movie{
+			{ID: 1, Rank: intPtr(2), Title: "Film Foo", Year: "1995-05-01", Rating: floatPtr(4.5), Budget: 10, Revenue: 100, Ratio: floatPtr(2), ProductionCompanies: []string{"Foo Studios"}},
+			{ID: 2, Rank: intPtr(1), Title: "Film Bar", Year: "2004-01-01", Rating: floatPtr(3), Budget: 30, Revenue: 50, Ratio: floatPtr(5), ProductionCompanies: []string{"Bar Studios"}},
+			{ID: 3, Title: "Film Baz", Year: "2010-12-31", Budget: 20, Revenue: 300, ProductionCompanies: []string{"Foo Studios", "Bar Studios"}},
+		},
+	}
+	handler := newMoviesHandler(store)
+
+	tests := []struct {
+		name       string
+		path       string
+		status     int
+		expectedID []int
+	}{
+		{
+			name:       "default sorted by ratio",
+			path:       "/movies",
+			status:     http.StatusOK,
+			expectedID: []int{2, 1, 3},
+		},
+		{
+			name:       "sort by budget",
+			path:       "/movies?sort=budget:asc",
+			status:     http.StatusOK,
+			expectedID: []int{1, 3, 2},
+		},
+		{
+			name:       "sort by revenue",
+			path:       "/movies?sort=revenue",
+			status:     http.StatusOK,
+			expectedID: []int{2, 1, 3},
+		},
+		{
+			name:       "sort by revenue descending",
+			path:       "/movies?sort=revenue:desc",
+			status:     http.StatusOK,
+			expectedID: []int{3, 1, 2},
+		},
+		{
+			name:       "sort by rank",
+			path:       "/movies?sort=rank",
+			status:     http.StatusOK,
+			expectedID: []int{2, 1, 3},
+		},
+		{
+			name:       "filter by year",
+			path:       "/movies?year_from=2000&year_to=2005",
+			status:     http.StatusOK,
+			expectedID: []int{2},
+		},
+		{
+			name:       "filter by company and rating",
+			path:       "/movies?company=Foo+Studios&min_rating=4",
+			status:     http.StatusOK,
+			expectedID: []int{1},
+		},
+		{
+			name:       "pagination",
+			path:       "/movies?limit=1&offset=1",
+			status:     http.StatusOK,
+			expectedID: []int{1},
+		},
+		{
+			name:       "empty page",
+			path:       "/movies?offset=10",
+			status:     http.StatusOK,
+			expectedID: []int{},
+		},
+		{
+			name:   "unknown sort column",
+			path:   "/movies?sort=title",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid limit",
+			path:   "/movies?limit=0",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+			require.Equal(t, test.status, rec.Code)
+			if test.status != http.StatusOK {
+				return
+			}
+
+			var res struct {
+				Movies []*movie `json:"movies"`
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			ids := []int{}
+			for _, m := range res.Movies {
+				ids = append(ids, m.ID)
+			}
+			require.Equal(t, test.expectedID, ids)
+		})
+	}
+}
+
+func Test_moviesHandlerGetMovie(t *testing.T) {
+	handler := newMoviesHandler(&memoryStore{
+		data: []*movie{{ID: 1, Title: "Film Foo", Year: "1995-05-01"}},
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/movies/1", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"id":1,"rank":null,"title":"Film Foo","year":"1995-05-01","rating":null,"budget":0,"revenue":0,"ratio":null,"production_companies":null,"url":"","abstract":""}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/movies/2", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/movies/1", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	// Errors from the store are returned before the response is started
+	handler = newMoviesHandler(&memoryStore{err: fmt.Errorf("connection refused")})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/movies", nil))
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.JSONEq(t, `{"error":"connection refused"}`, rec.Body.String())
+}
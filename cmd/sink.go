@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"top-movies/migrations"
+)
+
+// sink is a database the movies are loaded to
+type sink interface {
+	// migrations returns the migrations of the database schema, ordered by version
+	migrations() ([]*migration, error)
+	// appliedMigrations returns the versions of the migrations applied to the database along with when they were applied
+	appliedMigrations() (map[int]time.Time, error)
+	// runMigration applies or reverts a migration in a transaction, returning false if it had already been applied or reverted
+	runMigration(m *migration, up bool) (bool, error)
+	// load loads the ranked movies in a single transaction using `loadMode` and `loadSchema`.
+	// It returns the number of movies inserted, updated and deleted.
+	load(data []*combinedData, relations *movieRelations) (int64, int64, int64, error)
+	Close() error
+}
+
+// sqliteScheme is the scheme of the URI of SQLite databases, followed by the path of the database file
+const sqliteScheme = "sqlite://"
+
+// openSink connects to the database at `url`, which is a SQLite database for `sqlite:///path/to/file.db`
+// URIs and a Postgres database otherwise
+func openSink(url string) (sink, error) {
+	if strings.HasPrefix(url, sqliteScheme) {
+		return openSQLite(strings.TrimPrefix(url, sqliteScheme))
+	}
+
+	db, err := connect(url)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPostgresSink(db), nil
+}
+
+// postgresSink loads movies to a Postgres database
+type postgresSink struct {
+	*migrator
+}
+
+var _ sink = (*postgresSink)(nil)
+
+// postgresMigrationLockID is the key of the advisory lock held while a migration is applied,
+// so that migrations run concurrently against the same database are applied once
+const postgresMigrationLockID = 7358196
+
+func newPostgresSink(db *sql.DB) *postgresSink {
+	return &postgresSink{
+		migrator: &migrator{
+			db: db,
+			createTableStmt: `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);`,
+			tableExistsStmt: "SELECT to_regclass('schema_migrations') IS NOT NULL",
+			lockStmt:        fmt.Sprintf("SELECT pg_advisory_xact_lock(%d)", postgresMigrationLockID),
+		},
+	}
+}
+
+func (p *postgresSink) migrations() ([]*migration, error) {
+	return readMigrations(migrations.Postgres)
+}
+
+func (p *postgresSink) load(data []*combinedData, relations *movieRelations) (int64, int64, int64, error) {
+	var inserted, updated, deleted int64
+	err := inTransaction(p.db, func(tx *sql.Tx) error {
+		var err error
+		if loadSchema == schemaNormalised {
+			inserted, updated, deleted, err = loadNormalised(tx, data, relations)
+		} else {
+			inserted, updated, deleted, err = loadFlat(tx, data)
+		}
+		return err
+	})
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	return inserted, updated, deleted, nil
+}
+
+// inTransaction runs `fn` in a transaction which is committed if `fn` succeeds and rolled back otherwise
+func inTransaction(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *postgresSink) Close() error {
+	return p.db.Close()
+}
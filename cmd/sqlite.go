@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"top-movies/migrations"
+)
+
+// sqliteSink loads movies to a SQLite database file
+type sqliteSink struct {
+	*migrator
+}
+
+var _ sink = (*sqliteSink)(nil)
+
+// openSQLite opens the SQLite database at `path`, creating the file if it does not exist
+func openSQLite(path string) (*sqliteSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("SQLite URI has no database path, expected %s/path/to/file.db", sqliteScheme)
+	}
+
+	// Foreign keys are only enforced when enabled for each connection
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	fmt.Fprintln(logOutput, "Successfully opened SQLite database!")
+	return &sqliteSink{
+		migrator: &migrator{
+			db: db,
+			createTableStmt: `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);`,
+			tableExistsStmt: "SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')",
+		},
+	}, nil
+}
+
+func (s *sqliteSink) migrations() ([]*migration, error) {
+	return readMigrations(migrations.SQLite)
+}
+
+func (s *sqliteSink) load(data []*combinedData, relations *movieRelations) (int64, int64, int64, error) {
+	tables := []string{"topmovies"}
+	rows := normalisedRows{"topmovies": flatRows(data)}
+	if loadSchema == schemaNormalised {
+		tables = normalisedTables
+		rows = normalise(data, relations)
+	}
+
+	var inserted, updated, deleted int64
+	err := inTransaction(s.db, func(tx *sql.Tx) error {
+		var err error
+		inserted, updated, deleted, err = loadSQLiteRows(tx, tables, rows)
+		return err
+	})
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	return inserted, updated, deleted, nil
+}
+
+// loadSQLiteRows loads `rows` to `tables` using `loadMode`, where the first table holds the movies.
+// It returns the number of movies inserted, updated and deleted.
+func loadSQLiteRows(tx *sql.Tx, tables []string, rows normalisedRows) (int64, int64, int64, error) {
+	moviesTable := tables[0]
+
+	for _, table := range tables {
+		stmt := fmt.Sprintf("CREATE TEMP TABLE %[1]s_staging AS SELECT %[2]s FROM main.%[1]s WHERE false", table, strings.Join(tableColumns(table), ", "))
+		if _, err := tx.Exec(stmt); err != nil {
+			return 0, 0, 0, err
+		}
+		if err := insertRows(tx, table+"_staging", tableColumns(table), rows[table]); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	var inserted, updated, deleted int64
+	switch loadMode {
+	case loadReplace:
+		// Rows are deleted in reverse order so that rows are deleted before the rows they reference
+		for i := len(tables) - 1; i >= 0; i-- {
+			if _, err := tx.Exec("DELETE FROM " + tables[i]); err != nil {
+				return 0, 0, 0, err
+			}
+		}
+		for _, table := range tables {
+			if _, err := tx.Exec(insertStagingStmt(table, tableColumns(table))); err != nil {
+				return 0, 0, 0, err
+			}
+		}
+		inserted = int64(len(rows[moviesTable]))
+	case loadUpsert:
+		stmt := fmt.Sprintf("SELECT COUNT(*) FROM %[1]s_staging WHERE id NOT IN (SELECT id FROM %[1]s)", moviesTable)
+		if err := tx.QueryRow(stmt).Scan(&inserted); err != nil {
+			return 0, 0, 0, err
+		}
+		res, err := tx.Exec(upsertInsertStmt(moviesTable, tableColumns(moviesTable)))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		changed, err := res.RowsAffected()
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		updated = changed - inserted
+
+		if loadSchema == schemaNormalised {
+			for _, table := range []string{"companies", "people"} {
+				if _, err := tx.Exec(upsertInsertStmt(table, tableColumns(table))); err != nil {
+					return 0, 0, 0, err
+				}
+			}
+			// The companies and credits of the loaded movies are replaced
+			for _, table := range []string{"movie_companies", "movie_credits"} {
+				stmt := fmt.Sprintf("DELETE FROM %[1]s WHERE movie_id IN (SELECT id FROM movies_staging); INSERT INTO %[1]s (%[2]s) SELECT %[2]s FROM %[1]s_staging;", table, strings.Join(tableColumns(table), ", "))
+				if _, err := tx.Exec(stmt); err != nil {
+					return 0, 0, 0, err
+				}
+			}
+		}
+
+		if deleteMissing {
+			res, err := tx.Exec(fmt.Sprintf(deleteMissingStmt, moviesTable))
+			if err != nil {
+				return 0, 0, 0, err
+			}
+			if deleted, err = res.RowsAffected(); err != nil {
+				return 0, 0, 0, err
+			}
+		}
+	case loadAppend:
+		if loadSchema == schemaNormalised {
+			// Only the companies and credits of new movies are added
+			for _, table := range []string{"movie_companies", "movie_credits"} {
+				if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s_staging WHERE movie_id IN (SELECT id FROM movies)", table)); err != nil {
+					return 0, 0, 0, err
+				}
+			}
+		}
+		for _, table := range tables {
+			res, err := tx.Exec(appendStmt(table, tableColumns(table)))
+			if err != nil {
+				return 0, 0, 0, err
+			}
+			if table == moviesTable {
+				if inserted, err = res.RowsAffected(); err != nil {
+					return 0, 0, 0, err
+				}
+			}
+		}
+	}
+
+	// Temporary tables are kept until the connection is closed
+	for _, table := range tables {
+		if _, err := tx.Exec(fmt.Sprintf("DROP TABLE temp.%s_staging", table)); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	return inserted, updated, deleted, nil
+}
+
+// insertRows adds rows to `table`, with the values of each row given in the order of `columns`
+func insertRows(tx *sql.Tx, table string, columns []string, rows [][]interface{}) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), placeholders))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	values := make([]interface{}, len(columns))
+	for _, row := range rows {
+		for i, v := range row {
+			if values[i], err = sqliteValue(v); err != nil {
+				return err
+			}
+		}
+
+		if _, err := stmt.Exec(values...); err != nil {
+			return fmt.Errorf("could not add row to %s: %v", table, err)
+		}
+	}
+
+	return nil
+}
+
+// sqliteValue converts dates to text, lists to JSON arrays and missing values to NULL
+func sqliteValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case *float32:
+		if v == nil {
+			return nil, nil
+		}
+		return float64(*v), nil
+	case time.Time:
+		if v.IsZero() {
+			return nil, nil
+		}
+		return v.Format("2006-01-02"), nil
+	case float32:
+		return float64(v), nil
+	case []string:
+		if v == nil {
+			v = []string{}
+		}
+		list, err := json.Marshal(v)
+		return string(list), err
+	}
+	return v, nil
+}
+
+func (s *sqliteSink) Close() error {
+	return s.db.Close()
+}
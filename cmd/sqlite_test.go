@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_loadSQLite(t *testing.T) {
+	defer func() { loadMode, loadSchema, deleteMissing = loadReplace, schemaFlat, false }()
+
+	path := filepath.Join(t.TempDir(), "topmovies.db")
+	url := sqliteScheme + path
+	year, err := getTime("1995-10-30")
+	require.NoError(t, err)
+
+	data := func() []*combinedData {
+		return []*combinedData{
+			{id: "1", title: "film foo", year: year, rating: float32Ptr(4), budget: 10, revenue: 100, ratio: float32Ptr(10), productionCompanies: []string{"Foo Studios"}},
+			{id: "2", title: "film bar", budget: 10, revenue: 20},
+		}
+	}
+
+	// The schema must be migrated before loading
+	err = loadCombined(data(), nil, url)
+	require.EqualError(t, err, "database schema is out of date with 5 pending migrations, run the migrate up command to update it")
+	require.NoError(t, migrateUp(nil, []string{url}))
+
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	type row struct {
+		id, rank  int
+		title     string
+		year      sql.NullString
+		ratio     sql.NullFloat64
+		companies string
+	}
+	readRows := func() []row {
+		rows, err := db.Query("SELECT id, rank, title, CAST(year AS TEXT), ratio, production_companies FROM topmovies ORDER BY id")
+		require.NoError(t, err)
+		defer rows.Close()
+
+		res := []row{}
+		for rows.Next() {
+			var r row
+			require.NoError(t, rows.Scan(&r.id, &r.rank, &r.title, &r.year, &r.ratio, &r.companies))
+			res = append(res, r)
+		}
+		require.NoError(t, rows.Err())
+		return res
+	}
+
+	loadMode = loadReplace
+	require.NoError(t, loadCombined(data(), nil, url))
+	require.Equal(t, []row{
+		{id: 1, rank: 1, title: "film foo", year: sql.NullString{String: "1995-10-30", Valid: true}, ratio: sql.NullFloat64{Float64: 10, Valid: true}, companies: `["Foo Studios"]`},
+		// Missing ratios are loaded as NULL
+		{id: 2, rank: 2, title: "film bar", companies: `[]`},
+	}, readRows())
+
+	// Upserting updates changed movies and deletes movies which are not loaded
+	loadMode, deleteMissing = loadUpsert, true
+	updated := data()[:1]
+	updated[0].title = "film foo 2"
+	require.NoError(t, loadCombined(updated, nil, url))
+	require.Equal(t, []row{
+		{id: 1, rank: 1, title: "film foo 2", year: sql.NullString{String: "1995-10-30", Valid: true}, ratio: sql.NullFloat64{Float64: 10, Valid: true}, companies: `["Foo Studios"]`},
+	}, readRows())
+
+	// Appending leaves existing movies unchanged
+	loadMode, deleteMissing = loadAppend, false
+	require.NoError(t, loadCombined(data(), nil, url))
+	rows := readRows()
+	require.Len(t, rows, 2)
+	require.Equal(t, "film foo 2", rows[0].title)
+
+	// The normalised schema is loaded along with the companies and credits
+	loadMode, loadSchema = loadReplace, schemaNormalised
+	order := 0
+	relations := &movieRelations{
+		companies: map[string][]*company{"1": {{ID: 3, Name: "Foo Studios"}}},
+		credits: map[string][]*credit{
+			"1": {{PersonID: 10, Name: "Bob", Job: "Director", Department: "Directing", role: creditCrew}},
+			"2": {{PersonID: 10, Name: "Bob", Character: "Himself", Order: &order, role: creditCast}},
+		},
+	}
+	require.NoError(t, loadCombined(data(), relations, url))
+
+	var director string
+	var ratio float64
+	err = db.QueryRow(`
+SELECT people.name, AVG(movies.ratio)
+FROM movie_credits
+JOIN people ON people.id = movie_credits.person_id
+JOIN movies ON movies.id = movie_credits.movie_id
+WHERE movie_credits.job = 'Director'
+GROUP BY people.name`).Scan(&director, &ratio)
+	require.NoError(t, err)
+	require.Equal(t, "Bob", director)
+	require.EqualValues(t, 10, ratio)
+
+	var companies int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM movie_companies").Scan(&companies))
+	require.Equal(t, 1, companies)
+
+	// Migrations can be reverted
+	migrateSteps = 3
+	require.NoError(t, migrateDown(nil, []string{url}))
+	err = loadCombined(data(), relations, url)
+	require.EqualError(t, err, "database schema is out of date with 3 pending migrations, run the migrate up command to update it")
+}
+
+func Test_inTransaction(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "tx.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE t (id INTEGER)")
+	require.NoError(t, err)
+
+	// Changes are rolled back when the function fails and committed otherwise
+	err = inTransaction(db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec("INSERT INTO t VALUES (1)"); err != nil {
+			return err
+		}
+		return fmt.Errorf("failed")
+	})
+	require.EqualError(t, err, "failed")
+	require.NoError(t, inTransaction(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec("INSERT INTO t VALUES (2)")
+		return err
+	}))
+
+	var ids []int
+	rows, err := db.Query("SELECT id FROM t")
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		require.NoError(t, rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	require.Equal(t, []int{2}, ids)
+}
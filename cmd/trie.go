@@ -1,5 +1,7 @@
 package cmd
 
+import "sort"
+
 type trieNode struct {
 	children map[rune]*trieNode
 	values   []string
@@ -39,3 +41,89 @@ func (t *trieNode) walk(key []rune) []string {
 
 	return ids
 }
+
+// fuzzyRunesPerEdit is the number of runes a key needs for each edit allowed by `walkFuzzy`,
+// so that short titles such as "Up" are not matched by most Wikipedia titles
+const fuzzyRunesPerEdit = 4
+
+// trieMatch is a value found by `walkFuzzy` along with the edit distance between its key and a prefix of the searched key
+type trieMatch struct {
+	value    string
+	distance int
+}
+
+// walkFuzzy returns the values whose key is within `maxDistance` edits of a prefix of `key`, using the smallest
+// distance for each value. Each edit needs `fuzzyRunesPerEdit` runes of the matched key. Matches are ordered
+// by distance, with the values of exact matches returned in the same order as `walk`.
+func (t *trieNode) walkFuzzy(key []rune, maxDistance int) []trieMatch {
+	res := []trieMatch{}
+	seen := make(map[string]bool)
+	for _, id := range t.walk(key) {
+		if !seen[id] {
+			seen[id] = true
+			res = append(res, trieMatch{value: id})
+		}
+	}
+	if maxDistance <= 0 {
+		return res
+	}
+
+	// row[j] is the edit distance between the key of the current node and key[:j]
+	row := make([]int, len(key)+1)
+	for j := range row {
+		row[j] = j
+	}
+
+	distances := make(map[string]int)
+	for r, child := range t.children {
+		child.walkFuzzyNode(r, key, row, 1, maxDistance, distances)
+	}
+
+	fuzzy := make([]trieMatch, 0, len(distances))
+	for id, distance := range distances {
+		if distance > 0 && !seen[id] {
+			fuzzy = append(fuzzy, trieMatch{value: id, distance: distance})
+		}
+	}
+	sort.Slice(fuzzy, func(i, j int) bool {
+		if fuzzy[i].distance != fuzzy[j].distance {
+			return fuzzy[i].distance < fuzzy[j].distance
+		}
+		return compareValues(fuzzy[i].value, fuzzy[j].value, false) < 0
+	})
+
+	return append(res, fuzzy...)
+}
+
+// walkFuzzyNode continues the bounded Levenshtein search of `walkFuzzy` at the node reached by `r`,
+// given the row of the edit distances of its parent and the number of runes in its key
+func (t *trieNode) walkFuzzyNode(r rune, key []rune, previous []int, depth int, maxDistance int, distances map[string]int) {
+	row := make([]int, len(previous))
+	row[0] = previous[0] + 1
+	minDistance := row[0]
+	for j := 1; j < len(row); j++ {
+		cost := 1
+		if key[j-1] == r {
+			cost = 0
+		}
+		row[j] = minInt(row[j-1]+1, minInt(previous[j]+1, previous[j-1]+cost))
+		minDistance = minInt(minDistance, row[j])
+	}
+
+	if len(t.values) > 0 && minDistance <= minInt(maxDistance, depth/fuzzyRunesPerEdit) {
+		for _, id := range t.values {
+			if d, ok := distances[id]; !ok || minDistance < d {
+				distances[id] = minDistance
+			}
+		}
+	}
+
+	// The smallest distance never decreases with the depth of the key so no descendant can match
+	if minDistance > maxDistance {
+		return
+	}
+
+	for childRune, child := range t.children {
+		child.walkFuzzyNode(childRune, key, row, depth+1, maxDistance, distances)
+	}
+}
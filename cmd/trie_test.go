@@ -13,3 +13,61 @@ func Test_trie(t *testing.T) {
 	ids := trie.walk([]rune("films"))
 	require.Contains(t, ids, "0")
 }
+
+func Test_trieWalkFuzzy(t *testing.T) {
+	trie := newTrie()
+	trie.put([]rune("star wars"), "11")
+	trie.put([]rune("the godfather"), "238")
+	trie.put([]rune("the godfather part ii"), "240")
+	trie.put([]rune("up"), "14160")
+
+	tests := []struct {
+		name        string
+		key         string
+		maxDistance int
+		expected    []trieMatch
+	}{
+		{
+			name:        "exact prefix",
+			key:         "star wars: episode iv - a new hope",
+			maxDistance: 2,
+			expected:    []trieMatch{{value: "11"}},
+		},
+		{
+			name:        "exact only",
+			key:         "star-wars",
+			maxDistance: 0,
+			expected:    []trieMatch{},
+		},
+		{
+			name:        "punctuation",
+			key:         "star-wars",
+			maxDistance: 1,
+			expected:    []trieMatch{{value: "11", distance: 1}},
+		},
+		{
+			name:        "missing words",
+			key:         "godfather part ii",
+			maxDistance: 4,
+			expected:    []trieMatch{{value: "240", distance: 4}},
+		},
+		{
+			name:        "exact matches first",
+			key:         "the godfather part 2",
+			maxDistance: 2,
+			expected:    []trieMatch{{value: "238"}, {value: "240", distance: 2}},
+		},
+		{
+			name:        "short keys only match exactly",
+			key:         "us",
+			maxDistance: 2,
+			expected:    []trieMatch{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, trie.walkFuzzy([]rune(test.key), test.maxDistance))
+		})
+	}
+}
@@ -0,0 +1,30 @@
+// Package migrations holds the SQL migrations of the database schema, for each database the movies can be loaded to.
+//
+// Each migration has a version and is given by a pair of files `<version>_<name>.up.sql`,
+// which applies the migration, and `<version>_<name>.down.sql`, which reverts it.
+// Versions start at 1 and increase by 1 for each migration. The migrations of each database
+// have the same versions so that the schemas are the same at each version.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+var (
+	// Postgres holds the migrations of Postgres databases
+	Postgres = sub("postgres")
+	// SQLite holds the migrations of SQLite databases
+	SQLite = sub("sqlite")
+)
+
+func sub(dir string) fs.FS {
+	res, err := fs.Sub(files, dir)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
@@ -0,0 +1,13 @@
+-- Databases loaded before migrations were introduced already have the table
+CREATE TABLE IF NOT EXISTS topmovies (
+	id INTEGER PRIMARY KEY,
+	title TEXT,
+	year DATE,
+	rating REAL,
+	budget BIGINT,
+	revenue BIGINT,
+	ratio REAL,
+	production_companies TEXT[],
+	url TEXT,
+	abstract TEXT
+);
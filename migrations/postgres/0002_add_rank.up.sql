@@ -0,0 +1 @@
+ALTER TABLE topmovies ADD COLUMN IF NOT EXISTS rank INTEGER;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS movie_credits;
+DROP TABLE IF EXISTS movie_companies;
+DROP TABLE IF EXISTS people;
+DROP TABLE IF EXISTS companies;
+DROP TABLE IF EXISTS movies;
@@ -0,0 +1,45 @@
+-- Tables of the normalised schema, loaded with `load --schema normalised`
+CREATE TABLE movies (
+	id INTEGER PRIMARY KEY,
+	rank INTEGER,
+	title TEXT,
+	year DATE,
+	rating REAL,
+	budget BIGINT,
+	revenue BIGINT,
+	ratio REAL,
+	url TEXT,
+	abstract TEXT
+);
+
+CREATE TABLE companies (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL
+);
+
+CREATE TABLE people (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL
+);
+
+CREATE TABLE movie_companies (
+	movie_id INTEGER NOT NULL REFERENCES movies (id) ON DELETE CASCADE,
+	company_id INTEGER NOT NULL REFERENCES companies (id),
+	PRIMARY KEY (movie_id, company_id)
+);
+
+CREATE INDEX movie_companies_company_id_idx ON movie_companies (company_id);
+
+CREATE TABLE movie_credits (
+	movie_id INTEGER NOT NULL REFERENCES movies (id) ON DELETE CASCADE,
+	person_id INTEGER NOT NULL REFERENCES people (id),
+	role TEXT NOT NULL CHECK (role IN ('cast', 'crew')),
+	character TEXT,
+	department TEXT,
+	job TEXT,
+	cast_order INTEGER
+);
+
+CREATE INDEX movie_credits_movie_id_idx ON movie_credits (movie_id);
+CREATE INDEX movie_credits_person_id_idx ON movie_credits (person_id);
+CREATE INDEX movie_credits_job_idx ON movie_credits (job);
@@ -0,0 +1,5 @@
+-- Missing ratings and ratios were previously loaded as NaN
+UPDATE topmovies SET rating = NULL WHERE rating = 'NaN';
+UPDATE topmovies SET ratio = NULL WHERE ratio = 'NaN';
+UPDATE movies SET rating = NULL WHERE rating = 'NaN';
+UPDATE movies SET ratio = NULL WHERE ratio = 'NaN';
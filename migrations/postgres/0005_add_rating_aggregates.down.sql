@@ -0,0 +1,6 @@
+ALTER TABLE topmovies DROP COLUMN IF EXISTS rating_count;
+ALTER TABLE topmovies DROP COLUMN IF EXISTS rating_median;
+ALTER TABLE topmovies DROP COLUMN IF EXISTS weighted_rating;
+ALTER TABLE movies DROP COLUMN IF EXISTS rating_count;
+ALTER TABLE movies DROP COLUMN IF EXISTS rating_median;
+ALTER TABLE movies DROP COLUMN IF EXISTS weighted_rating;
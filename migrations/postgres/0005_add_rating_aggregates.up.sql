@@ -0,0 +1,6 @@
+ALTER TABLE topmovies ADD COLUMN IF NOT EXISTS rating_count INTEGER;
+ALTER TABLE topmovies ADD COLUMN IF NOT EXISTS rating_median REAL;
+ALTER TABLE topmovies ADD COLUMN IF NOT EXISTS weighted_rating REAL;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating_count INTEGER;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating_median REAL;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS weighted_rating REAL;
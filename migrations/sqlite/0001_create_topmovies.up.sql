@@ -0,0 +1,13 @@
+-- Production companies are stored as a JSON array, which can be queried with json_each
+CREATE TABLE topmovies (
+	id INTEGER PRIMARY KEY,
+	title TEXT,
+	year DATE,
+	rating REAL,
+	budget INTEGER,
+	revenue INTEGER,
+	ratio REAL,
+	production_companies TEXT,
+	url TEXT,
+	abstract TEXT
+);
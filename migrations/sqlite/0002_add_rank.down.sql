@@ -0,0 +1 @@
+ALTER TABLE topmovies DROP COLUMN rank;
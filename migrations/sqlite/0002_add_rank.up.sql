@@ -0,0 +1 @@
+ALTER TABLE topmovies ADD COLUMN rank INTEGER;
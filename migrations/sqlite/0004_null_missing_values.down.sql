@@ -0,0 +1,2 @@
+-- Missing values are kept as NULL as they cannot be told apart from values which were always NULL
+SELECT 1;
@@ -0,0 +1,2 @@
+-- SQLite stores NaN as NULL so there are no NaN values to replace
+SELECT 1;
@@ -0,0 +1,6 @@
+ALTER TABLE topmovies DROP COLUMN rating_count;
+ALTER TABLE topmovies DROP COLUMN rating_median;
+ALTER TABLE topmovies DROP COLUMN weighted_rating;
+ALTER TABLE movies DROP COLUMN rating_count;
+ALTER TABLE movies DROP COLUMN rating_median;
+ALTER TABLE movies DROP COLUMN weighted_rating;
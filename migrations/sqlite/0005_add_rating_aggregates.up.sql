@@ -0,0 +1,6 @@
+ALTER TABLE topmovies ADD COLUMN rating_count INTEGER;
+ALTER TABLE topmovies ADD COLUMN rating_median REAL;
+ALTER TABLE topmovies ADD COLUMN weighted_rating REAL;
+ALTER TABLE movies ADD COLUMN rating_count INTEGER;
+ALTER TABLE movies ADD COLUMN rating_median REAL;
+ALTER TABLE movies ADD COLUMN weighted_rating REAL;